@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes in a hunk.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	a, b int // line numbers in a and b, starting at 1
+}
+
+// unifiedDiff returns the unified diff from a to b labeled by aName and bName,
+// or an empty string if they are equal.
+func unifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk while changes are close enough
+		end := start
+		for i := start; i < len(ops) && i <= end+2*diffContext; i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			}
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext+1, len(ops))
+		writeHunk(&buf, ops[from:to])
+		start = to
+	}
+
+	return buf.String()
+}
+
+func writeHunk(buf *bytes.Buffer, ops []diffOp) {
+	aStart, bStart := ops[0].a, ops[0].b
+	var aLen, bLen int
+	for _, op := range ops {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	// an empty range starts at the line before it
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, op := range ops {
+		fmt.Fprintf(buf, "%c%s\n", op.kind, op.line)
+	}
+}
+
+// diffLines returns the shortest edit script from a to b by the linear space
+// variant of the Myers' algorithm, which takes O((N+M)D) time for N and M lines
+// with D differences.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	diffRange(&ops, a, b, 0, 0)
+
+	// list deletions before insertions in each run of changes
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		var dels, ins []string
+		for ; j < len(ops) && ops[j].kind != ' '; j++ {
+			if ops[j].kind == '-' {
+				dels = append(dels, ops[j].line)
+			} else {
+				ins = append(ins, ops[j].line)
+			}
+		}
+		aStart, bStart := ops[i].a, ops[i].b
+		for k, line := range dels {
+			ops[i+k] = diffOp{'-', line, aStart + k, bStart}
+		}
+		for k, line := range ins {
+			ops[i+len(dels)+k] = diffOp{'+', line, aStart + len(dels), bStart + k}
+		}
+		i = j
+	}
+	return ops
+}
+
+// diffRange appends the edit script from a to b to ops.
+// a and b start at the lines aOff+1 and bOff+1.
+func diffRange(ops *[]diffOp, a, b []string, aOff, bOff int) {
+	// common prefix and suffix
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	equal := func(from, to, bFrom int) {
+		for i := from; i < to; i++ {
+			*ops = append(*ops, diffOp{' ', a[i], aOff + i + 1, bOff + bFrom + i - from + 1})
+		}
+	}
+
+	equal(0, pre, 0)
+	n, m := len(a)-suf, len(b)-suf
+	switch {
+	case pre == n:
+		for j := pre; j < m; j++ {
+			*ops = append(*ops, diffOp{'+', b[j], aOff + pre + 1, bOff + j + 1})
+		}
+	case pre == m:
+		for i := pre; i < n; i++ {
+			*ops = append(*ops, diffOp{'-', a[i], aOff + i + 1, bOff + pre + 1})
+		}
+	default:
+		x, y, u, v := middleSnake(a[pre:n], b[pre:m])
+		diffRange(ops, a[pre:pre+x], b[pre:pre+y], aOff+pre, bOff+pre)
+		equal(pre+x, pre+u, pre+y)
+		diffRange(ops, a[pre+u:n], b[pre+v:m], aOff+pre+u, bOff+pre+v)
+	}
+	equal(n, len(a), m)
+}
+
+// middleSnake returns the diagonal from (x, y) to (u, v) in the middle of
+// a shortest edit script from a to b, which are not empty.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	limit := (n + m + 1) / 2
+	delta := n - m
+	// furthest x on the diagonal k = x - y, indexed by k+off,
+	// searching forward from the start and backward from the end
+	off := limit + 1
+	fwd := make([]int, 2*limit+3)
+	bwd := make([]int, 2*limit+3)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := fwd[off+k-1] + 1
+			if k == -d || k != d && fwd[off+k-1] < fwd[off+k+1] {
+				x = fwd[off+k+1]
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			fwd[off+k] = x
+			// the backward diagonal reaching the same point
+			if kb := delta - k; delta%2 != 0 && kb >= -(d-1) && kb <= d-1 && x+bwd[off+kb] >= n {
+				return x0, y0, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			x := bwd[off+k-1] + 1
+			if k == -d || k != d && bwd[off+k-1] < bwd[off+k+1] {
+				x = bwd[off+k+1]
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			bwd[off+k] = x
+			if kf := delta - k; delta%2 == 0 && kf >= -d && kf <= d && x+fwd[off+kf] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+	panic("interfake: no middle snake")
+}
+
+func splitLines(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns the lines from 1 to n, replacing the line i with r[i].
+func numberedLines(n int, r map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if s, ok := r[i]; ok {
+			b.WriteString(s + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			"equal",
+			"a\nb\n",
+			"a\nb\n",
+			"",
+		},
+		{
+			"insert",
+			"1\n2\n3\n",
+			"1\n2\nx\n3\n",
+			"@@ -1,3 +1,4 @@\n 1\n 2\n+x\n 3\n",
+		},
+		{
+			"delete",
+			"1\n2\n3\n",
+			"1\n3\n",
+			"@@ -1,3 +1,2 @@\n 1\n-2\n 3\n",
+		},
+		{
+			"new file",
+			"",
+			"x\ny\n",
+			"@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			"removed file",
+			"x\ny\n",
+			"",
+			"@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			"change at start",
+			numberedLines(6, nil),
+			numberedLines(6, map[int]string{1: "A"}),
+			"@@ -1,4 +1,4 @@\n-1\n+A\n 2\n 3\n 4\n",
+		},
+		{
+			"change at end",
+			numberedLines(6, nil),
+			numberedLines(6, map[int]string{6: "F"}),
+			"@@ -3,4 +3,4 @@\n 3\n 4\n 5\n-6\n+F\n",
+		},
+		{
+			"nearby changes merged",
+			numberedLines(10, nil),
+			numberedLines(10, map[int]string{2: "B", 8: "H"}),
+			"@@ -1,10 +1,10 @@\n 1\n-2\n+B\n 3\n 4\n 5\n 6\n 7\n-8\n+H\n 9\n 10\n",
+		},
+		{
+			"distant changes split",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{2: "B", 18: "R"}),
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+B\n 3\n 4\n 5\n@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+R\n 19\n 20\n",
+		},
+		{
+			"changes at both ends of a large file",
+			numberedLines(10000, nil),
+			numberedLines(10000, map[int]string{1: "A", 10000: "Z"}),
+			"@@ -1,4 +1,4 @@\n-1\n+A\n 2\n 3\n 4\n@@ -9997,4 +9997,4 @@\n 9997\n 9998\n 9999\n-10000\n+Z\n",
+		},
+	}
+
+	for _, tt := range cases {
+		expected := tt.expected
+		if expected != "" {
+			expected = "--- a\n+++ b\n" + expected
+		}
+		actual := unifiedDiff("a", "b", []byte(tt.a), []byte(tt.b))
+		if actual != expected {
+			t.Errorf("%s: expected %q actual %q", tt.name, expected, actual)
+		}
+	}
+}
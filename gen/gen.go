@@ -0,0 +1,199 @@
+// Package gen loads Go interfaces and generates their fake implementations.
+// It is the library behind the interfake command.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"text/template"
+
+	"github.com/y0za/interfake/model"
+)
+
+// Options configures loading interfaces and generating their fakes.
+type Options struct {
+	// Dir is the directory of the source package, or the directory relative to which
+	// SourcePackage is resolved. The current directory is used if empty.
+	Dir string
+	// SourcePackage is the import path of the package declaring the interfaces.
+	SourcePackage string
+	// Source is the Go source file declaring the interfaces,
+	// exclusive with SourcePackage. With Typecheck, it is checked
+	// together with the other files of its package.
+	Source string
+	// Targets are the names of the interfaces.
+	// All exported interfaces are loaded if empty.
+	Targets []string
+	// Typecheck loads interfaces with type checking by go/types.
+	Typecheck bool
+	// AllErrors reports all errors found in the source files instead of only the first one.
+	AllErrors bool
+	// Warn is called with the errors of the skipped interfaces which are not targets.
+	// It may be nil.
+	Warn func(error)
+
+	// Package is the package name of the generated code.
+	Package string
+	// PackagePath is the import path of the generated code, which may be empty.
+	// It ends with _test in an external test package.
+	// Types declared in the package are not qualified.
+	PackagePath string
+	// Mode is the kind of the generated implementation.
+	Mode Mode
+	// Unset is the behavior of fake methods whose func is not set.
+	Unset UnsetMode
+	// Assert asserts the generated types implement the interfaces at compile time.
+	Assert bool
+	// Constructor generates NewFakeX constructors.
+	Constructor bool
+	// Template generates the implementation of each interface instead of
+	// the built-in one of Mode if set. It must be parsed by ParseTemplate.
+	Template *template.Template
+	// TypeName is the pattern of the name of the generated type such as Stub<Interface>.
+	// It is Fake<Interface>, Mock<Interface> or Spy<Interface> by Mode if empty.
+	TypeName string
+	// TypeNames overrides the name of the generated type by the interface name.
+	TypeNames map[string]string
+	// FieldName is the pattern of the name of the func field handling a method
+	// such as <Method>Func. It is Fake<Method> if empty.
+	FieldName string
+}
+
+// Load loads the target interfaces of opts from the source files,
+// and returns them with the name of the package declaring them.
+func Load(opts Options) ([]*model.Interface, string, error) {
+	files, err := LoadFiles(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(opts.Targets) == 0 {
+		intfs, pkg := ExportedInterfaces(files)
+		if len(intfs) == 0 {
+			return nil, "", fmt.Errorf("not found exported interface")
+		}
+		return intfs, pkg, nil
+	}
+	return SeekInterfaces(files, opts.Targets)
+}
+
+// LoadFiles loads every interface in the source files of opts.
+// Interfaces failed to load are skipped unless they are opts.Targets.
+func LoadFiles(opts Options) ([]*model.GoFile, error) {
+	if opts.Source != "" && opts.SourcePackage != "" {
+		return nil, fmt.Errorf("source can't be used with source package")
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	sopts := sourceOptions{
+		allErrors: opts.AllErrors,
+		targets:   opts.Targets,
+		warn:      opts.Warn,
+	}
+
+	switch {
+	case opts.Source != "" && opts.Typecheck:
+		return loadSourceFile(opts.Source, sopts)
+	case opts.Source != "":
+		return parseFiles([]string{opts.Source}, PackagePath(opts.Source), sopts)
+	case opts.SourcePackage != "" && opts.Typecheck:
+		return loadPackage(opts.SourcePackage, dir, sopts)
+	case opts.SourcePackage != "":
+		return parsePackage(opts.SourcePackage, dir, sopts)
+	case opts.Typecheck:
+		return loadPackageDir(dir, sopts)
+	default:
+		return parsePackageDir(dir, sopts)
+	}
+}
+
+// Generate generates the formatted code of fake implementations of intfs
+// in the package opts.Package.
+func Generate(intfs []*model.Interface, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		return nil, fmt.Errorf("package name of the generated code is required")
+	}
+
+	g := NewGenerator()
+	g.Mode = opts.Mode
+	g.Unset = opts.Unset
+	g.Assert = opts.Assert
+	g.Constructor = opts.Constructor
+	g.Template = opts.Template
+	g.TypeName = opts.TypeName
+	g.TypeNames = opts.TypeNames
+	g.FieldName = opts.FieldName
+	err := g.Generate(intfs, opts.Package, opts.PackagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating code: %v", err)
+	}
+	err = g.Format()
+	if err != nil {
+		return nil, fmt.Errorf("failed formatting code: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = g.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SeekInterface finds the interface interfaceName in files,
+// and returns it with the name of the package declaring it.
+// It returns nil if not found.
+func SeekInterface(files []*model.GoFile, interfaceName string) (*model.Interface, string) {
+	for _, f := range files {
+		for _, i := range f.Interfaces {
+			if i.Name == interfaceName {
+				return i, f.PackageName
+			}
+		}
+	}
+	return nil, ""
+}
+
+// SeekInterfaces finds every interface of interfaceNames in files.
+func SeekInterfaces(files []*model.GoFile, interfaceNames []string) ([]*model.Interface, string, error) {
+	var intfs []*model.Interface
+	var pkg string
+	for _, name := range interfaceNames {
+		intf, p := SeekInterface(files, name)
+		if intf == nil {
+			return nil, "", fmt.Errorf("not found interface %s", name)
+		}
+		intfs = append(intfs, intf)
+		pkg = p
+	}
+	return intfs, pkg, nil
+}
+
+// ExportedInterfaces returns all exported interfaces in files.
+func ExportedInterfaces(files []*model.GoFile) ([]*model.Interface, string) {
+	var intfs []*model.Interface
+	var pkg string
+	for _, f := range files {
+		for _, i := range f.Interfaces {
+			if ast.IsExported(i.Name) {
+				intfs = append(intfs, i)
+				pkg = f.PackageName
+			}
+		}
+	}
+	return intfs, pkg
+}
+
+// PackagePath returns the import path of the package of the file name.
+// It returns an empty string if name is empty.
+func PackagePath(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	return DirPackagePath(filepath.Dir(name))
+}
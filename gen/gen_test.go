@@ -0,0 +1,596 @@
+package gen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// writeModule writes files into a new module example.com/t and returns its directory.
+// The working directory is changed to the module, in which go/types resolves
+// the packages of the module as go:generate does.
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/t\n\ngo 1.22\n"
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(name), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(name, []byte(content), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generate loads the interfaces of opts from the module dir,
+// and writes their generated code into the file name of the module.
+func generate(t *testing.T, dir, name string, opts Options) string {
+	t.Helper()
+	opts.Dir = dir
+	intfs, _, err := Load(opts)
+	if err != nil {
+		t.Fatalf("failed loading: %v", err)
+	}
+	name = filepath.Join(dir, name)
+	if opts.PackagePath == "" {
+		opts.PackagePath = PackagePath(name)
+	}
+	code, err := Generate(intfs, opts)
+	if err != nil {
+		t.Fatalf("failed generating: %v", err)
+	}
+	writeFile(t, name, string(code))
+	return string(code)
+}
+
+// vet compiles the module dir including its tests, and reports errors.
+func vet(t *testing.T, dir string) {
+	t.Helper()
+	cmd := exec.Command("go", "vet", "./...")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("go vet failed: %v\n%s", err, out)
+	}
+}
+
+// goTest runs the tests of the module dir using the generated code, and reports failures.
+func goTest(t *testing.T, dir string) {
+	t.Helper()
+	cmd := exec.Command("go", "test", "./...")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("go test failed: %v\n%s", err, out)
+	}
+}
+
+func TestOverlappingMethods(t *testing.T) {
+	cases := []struct {
+		name    string
+		members string
+	}{
+		{"explicit first", "Close() error\n\tio.Closer"},
+		{"embedded first", "io.Closer\n\tClose() error"},
+	}
+
+	for _, tt := range cases {
+		for _, typecheck := range []bool{false, true} {
+			dir := writeModule(t, map[string]string{
+				"a.go": "package t\n\nimport \"io\"\n\ntype C interface {\n\t" + tt.members + "\n}\n",
+			})
+			opts := Options{Dir: dir, Targets: []string{"C"}, Typecheck: typecheck, Package: "t"}
+			intfs, _, err := Load(opts)
+			if err != nil {
+				t.Errorf("%s (typecheck %v): %v", tt.name, typecheck, err)
+				continue
+			}
+			if n := len(intfs[0].Methods); n != 1 {
+				t.Errorf("%s (typecheck %v): expected 1 method actual %d", tt.name, typecheck, n)
+			}
+			generate(t, dir, "fake_c.go", opts)
+			vet(t, dir)
+		}
+	}
+}
+
+func TestTestSourceFile(t *testing.T) {
+	cases := []struct {
+		source      string
+		target      string
+		pkg         string
+		packagePath string
+	}{
+		{"x_test.go", "Store", "t_test", "example.com/t_test"},
+		{"y_test.go", "Repo", "t", "example.com/t"},
+	}
+
+	for _, tt := range cases {
+		for _, typecheck := range []bool{false, true} {
+			dir := writeModule(t, map[string]string{
+				"user.go":   "package t\n\ntype User struct{ Name string }\n",
+				"x_test.go": "package t_test\n\nimport \"example.com/t\"\n\ntype Store interface {\n\tGet(id int) (*t.User, error)\n}\n",
+				"y_test.go": "package t\n\ntype Repo interface {\n\tFind(id int) *User\n}\n",
+			})
+			opts := Options{
+				Source:      filepath.Join(dir, tt.source),
+				Targets:     []string{tt.target},
+				Typecheck:   typecheck,
+				Package:     tt.pkg,
+				PackagePath: tt.packagePath,
+			}
+			generate(t, dir, "fake_"+tt.source, opts)
+			vet(t, dir)
+		}
+	}
+}
+
+func TestUnexportedMethods(t *testing.T) {
+	for _, mode := range []Mode{ModeFake, ModeMock, ModeSpy} {
+		dir := writeModule(t, map[string]string{
+			"a.go": "package t\n\ntype s interface {\n\tput(v int)\n\tget() (int, error)\n}\n",
+		})
+		opts := Options{Dir: dir, Targets: []string{"s"}, Package: "t", Mode: mode}
+		generate(t, dir, "fake_s.go", opts)
+		vet(t, dir)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	cases := []struct {
+		members  string
+		expected string
+	}{
+		{"M(a [len(\"ab\")]int)", "4:7: failed parsing arguments: don't know how to parse constant expression *ast.CallExpr"},
+		{"M() [len(\"ab\")]int", "4:7: failed parsing results: don't know how to parse constant expression *ast.CallExpr"},
+		{"M(a [m]int)", "4:7: failed parsing arguments: not found constant m in package example.com/t"},
+		{"Missing", "4:2: failed embedding interface Missing: not found interface Missing in package example.com/t"},
+		{"I", "4:2: failed embedding interface I: interface I embeds itself"},
+	}
+
+	pos := regexp.MustCompile(`\.go:\d+:\d+: `)
+	for _, tt := range cases {
+		dir := writeModule(t, map[string]string{
+			"a.go": "package t\n\ntype I interface {\n\t" + tt.members + "\n}\n",
+		})
+		_, _, err := Load(Options{Dir: dir, Targets: []string{"I"}})
+		if err == nil {
+			t.Errorf("%s: expected error", tt.members)
+			continue
+		}
+		expected := filepath.Join(dir, "a.go") + ":" + tt.expected
+		if n := len(pos.FindAllString(err.Error(), -1)); n != 1 || err.Error() != expected {
+			t.Errorf(`%s: expected "%s" actual "%s"`, tt.members, expected, err)
+		}
+	}
+}
+
+func TestArrayLengthConstants(t *testing.T) {
+	cases := []struct {
+		typecheck bool
+		expected  string
+	}{
+		{false, "FakeM func([dep.Size]byte, [3]int, [2 * 2]int, [19]byte, [2 * md5.Size]byte)"},
+		{true, "FakeM func([4]byte, [3]int, [4]int, [19]byte, [32]byte)"},
+	}
+
+	for _, tt := range cases {
+		dir := writeModule(t, map[string]string{
+			"dep/dep.go": "package dep\n\nconst Size = 4\n",
+			"a.go": `package t
+
+import (
+	"crypto/md5"
+
+	. "example.com/t/dep"
+)
+
+const n = 3
+
+const (
+	k = 1 << iota
+	l
+)
+
+const sum = md5.Size + n
+
+type I interface {
+	M(a [Size]byte, b [n]int, c [l * 2]int, d [sum]byte, e [2 * md5.Size]byte)
+}
+`,
+		})
+		opts := Options{Dir: dir, Targets: []string{"I"}, Typecheck: tt.typecheck, Package: "fake"}
+		code := generate(t, dir, "fake/fake_i.go", opts)
+		vet(t, dir)
+		if !strings.Contains(code, tt.expected) {
+			t.Errorf("typecheck %v: expected \"%s\" in\n%s", tt.typecheck, tt.expected, code)
+		}
+	}
+}
+
+func TestNameClashes(t *testing.T) {
+	cases := []struct {
+		methods  string
+		opts     Options
+		expected string
+	}{
+		{
+			"Get() int\n\tFakeGet()",
+			Options{},
+			"FakeI.FakeGet is declared more than once",
+		},
+		{
+			"Get() int\n\tGetFunc()",
+			Options{FieldName: "<Method>Func"},
+			"FakeI.GetFunc is declared more than once",
+		},
+		{
+			"Get() int",
+			Options{TypeNames: map[string]string{"I": "I"}},
+			"I is declared more than once",
+		},
+		{
+			"Get() int",
+			Options{TypeNames: map[string]string{"I": "FakeJ"}},
+			"FakeJ is declared more than once",
+		},
+	}
+
+	for _, tt := range cases {
+		dir := writeModule(t, map[string]string{
+			"a.go": "package t\n\ntype I interface {\n\t" + tt.methods + "\n}\n\ntype J interface {\n\tI\n}\n",
+		})
+		opts := tt.opts
+		opts.Dir = dir
+		opts.Targets = []string{"I", "J"}
+		intfs, _, err := Load(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Package = "t"
+		opts.PackagePath = "example.com/t"
+		_, err = Generate(intfs, opts)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf(`expected "%s" actual "%v"`, tt.expected, err)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	cases := []struct {
+		mode     Mode
+		opts     Options
+		expected []string
+	}{
+		{
+			ModeFake,
+			Options{TypeName: "Stub<Interface>", FieldName: "<Method>Func"},
+			[]string{"type StubI struct", "GetFunc func(string) (int, error)", "PutFunc func(string, int)", "type StubJ struct"},
+		},
+		{
+			ModeMock,
+			Options{TypeName: "Stub<Interface>", FieldName: "<Method>Func"},
+			[]string{"type StubI struct", "type StubJ struct"},
+		},
+		{
+			ModeSpy,
+			Options{TypeName: "Stub<Interface>", FieldName: "<Method>Func"},
+			[]string{"type StubI struct", "type StubJ struct"},
+		},
+		{
+			ModeFake,
+			Options{TypeName: "Stub<Interface>", TypeNames: map[string]string{"I": "Store"}},
+			[]string{"type Store struct", "FakeGet func(string) (int, error)", "type StubJ struct"},
+		},
+	}
+
+	for _, tt := range cases {
+		dir := writeModule(t, map[string]string{
+			"a.go": "package t\n\ntype I interface {\n\tGet(k string) (int, error)\n\tPut(k string, v int)\n}\n\ntype J interface {\n\tI\n}\n",
+		})
+		opts := tt.opts
+		opts.Dir = dir
+		opts.Targets = []string{"I", "J"}
+		opts.Package = "t"
+		opts.Mode = tt.mode
+		code := generate(t, dir, "fake.go", opts)
+		vet(t, dir)
+		for _, e := range tt.expected {
+			if !strings.Contains(code, e) {
+				t.Errorf("%s: expected \"%s\" in\n%s", tt.mode, e, code)
+			}
+		}
+	}
+}
+
+const storeSource = `package t
+
+type Store interface {
+	Get(k string) (int, error)
+	Put(k string, v int)
+}
+`
+
+func TestFakeRun(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": storeSource,
+		"a_test.go": `package t
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFakeStore(t *testing.T) {
+	f := &FakeStore{}
+	f.GetReturns(1, nil)
+	f.GetReturnsSequence(FakeStoreGetResults{R0: 2}, FakeStoreGetResults{R0: 3})
+	f.GetReturnsOnCall(1, 10, nil)
+
+	var got []int
+	for i := 0; i < 4; i++ {
+		v, _ := f.Get("k")
+		got = append(got, v)
+	}
+	// ReturnsOnCall precedes the sequence, which precedes Returns until it runs out
+	if want := []int{2, 10, 3, 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v actual %v", want, got)
+	}
+
+	f.FakeGet = func(k string) (int, error) { return len(k), nil }
+	if v, _ := f.Get("abc"); v != 3 {
+		t.Errorf("expected FakeGet result 3 actual %d", v)
+	}
+	f.FakePut = func(string, int) {}
+	f.Put("a", 1)
+
+	if n := f.GetCallCount(); n != 5 {
+		t.Errorf("expected 5 calls actual %d", n)
+	}
+	if k := f.GetArgsForCall(4); k != "abc" {
+		t.Errorf("expected argument abc actual %s", k)
+	}
+	if c := f.PutCalls(); len(c) != 1 || c[0].Seq != 6 || c[0].Arg0 != "a" || c[0].Arg1 != 1 {
+		t.Errorf("unexpected calls %+v", c)
+	}
+}
+`,
+	})
+	generate(t, dir, "fake.go", Options{Dir: dir, Targets: []string{"Store"}, Package: "t"})
+	goTest(t, dir)
+}
+
+func TestMockRun(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": storeSource,
+		"b.go": "package t\n\ntype Closer interface {\n\tClose() error\n}\n",
+		"a_test.go": `package t
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// recorder records errors and cleanups of a mock instead of failing the test.
+type recorder struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recorder) verify() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+
+func TestMockStore(t *testing.T) {
+	r := &recorder{TB: t}
+	m := NewMockStore(r)
+	m.ExpectGet("a").Returns(1, nil)
+	m.ExpectPut("b", 2).Times(2)
+
+	if v, _ := m.Get("a"); v != 1 {
+		t.Errorf("expected 1 actual %d", v)
+	}
+	m.Put("b", 2)
+	m.Get("x")
+	r.verify()
+
+	want := []string{
+		"interfake: unexpected call of Store.Get(x)",
+		"interfake: missing call of Store.Put: expected 2 times, called 1 times",
+	}
+	if fmt.Sprint(r.errs) != fmt.Sprint(want) {
+		t.Errorf("expected %q actual %q", want, r.errs)
+	}
+}
+
+func TestMockCloser(t *testing.T) {
+	r := &recorder{TB: t}
+	m := NewMockCloser(r)
+	errClosed := errors.New("closed")
+	m.ExpectClose().Returns(errClosed)
+
+	if err := m.Close(); err != errClosed {
+		t.Errorf("expected %v actual %v", errClosed, err)
+	}
+	r.verify()
+	if len(r.errs) > 0 {
+		t.Errorf("unexpected errors %q", r.errs)
+	}
+}
+`,
+	})
+	generate(t, dir, "mock_store.go", Options{Dir: dir, Targets: []string{"Store"}, Package: "t", Mode: ModeMock})
+	generate(t, dir, "mock_closer.go", Options{Dir: dir, Targets: []string{"Closer"}, Package: "t", Mode: ModeMock})
+	goTest(t, dir)
+}
+
+func TestSpyRun(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": storeSource,
+		"a_test.go": `package t
+
+import (
+	"errors"
+	"testing"
+)
+
+type mapStore map[string]int
+
+func (s mapStore) Get(k string) (int, error) {
+	v, ok := s[k]
+	if !ok {
+		return 0, errors.New("not found")
+	}
+	return v, nil
+}
+
+func (s mapStore) Put(k string, v int) {
+	s[k] = v
+}
+
+func TestSpyStore(t *testing.T) {
+	s := NewSpyStore(mapStore{})
+	s.Put("a", 1)
+	if v, err := s.Get("a"); v != 1 || err != nil {
+		t.Errorf("expected 1, <nil> actual %d, %v", v, err)
+	}
+	s.FakeGet = func(string) (int, error) { return 2, nil }
+	if v, _ := s.Get("b"); v != 2 {
+		t.Errorf("expected FakeGet result 2 actual %d", v)
+	}
+
+	if n := s.GetCallCount(); n != 2 {
+		t.Errorf("expected 2 calls actual %d", n)
+	}
+	if v, err := s.GetResultsForCall(0); v != 1 || err != nil {
+		t.Errorf("expected recorded 1, <nil> actual %d, %v", v, err)
+	}
+	if c := s.GetCalls(); c[1].Seq != 3 || c[1].Arg0 != "b" || c[1].R0 != 2 {
+		t.Errorf("unexpected calls %+v", c)
+	}
+	if k, v := s.PutArgsForCall(0); k != "a" || v != 1 {
+		t.Errorf("expected arguments a, 1 actual %s, %d", k, v)
+	}
+}
+`,
+	})
+	generate(t, dir, "spy.go", Options{Dir: dir, Targets: []string{"Store"}, Package: "t", Mode: ModeSpy})
+	goTest(t, dir)
+}
+
+func TestSpyUnreferable(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": "package t\n\ntype store interface {\n\tGet(k string) (int, error)\n}\n",
+	})
+	opts := Options{Dir: dir, Targets: []string{"store"}, Package: "fake", Mode: ModeSpy}
+	intfs, _, err := Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.PackagePath = "example.com/t/fake"
+	_, err = Generate(intfs, opts)
+	if err == nil || !strings.Contains(err.Error(), "can't be referred") {
+		t.Errorf(`expected "can't be referred" actual "%v"`, err)
+	}
+}
+
+func TestMainPackage(t *testing.T) {
+	for _, typecheck := range []bool{false, true} {
+		dir := writeModule(t, map[string]string{
+			"main.go": "package main\n\ntype Store interface {\n\tGet(k string) (int, error)\n}\n\nfunc main() {}\n",
+		})
+		opts := Options{Dir: dir, Targets: []string{"Store"}, Typecheck: typecheck, Package: "fake", Assert: true}
+		code := generate(t, dir, "fake/fake_store.go", opts)
+		vet(t, dir)
+		if strings.Contains(code, `"example.com/t"`) {
+			t.Errorf("typecheck %v: expected no import of the main package in\n%s", typecheck, code)
+		}
+	}
+}
+
+func TestTemplateImports(t *testing.T) {
+	cases := []struct {
+		name       string
+		text       string
+		imported   []string
+		unimported []string
+	}{
+		{
+			"no types",
+			"type {{.TypeName}} struct{}\n",
+			nil,
+			[]string{`"example.com/t"`, `"time"`},
+		},
+		{
+			"parameter types",
+			"type {{.TypeName}} struct{}\n{{range .Interface.Methods}}\nfunc ({{$.TypeName}}) {{.Name}}({{formalArgs .Args}}) {}\n{{end}}",
+			[]string{`"time"`},
+			[]string{`"example.com/t"`},
+		},
+		{
+			"interface type",
+			"type {{.TypeName}} struct{}\n\nvar _ = (*{{.InterfaceType}})(nil)\n",
+			[]string{`"example.com/t"`},
+			[]string{`"time"`},
+		},
+	}
+
+	for _, tt := range cases {
+		dir := writeModule(t, map[string]string{
+			"a.go": "package t\n\nimport \"time\"\n\ntype Timer interface {\n\tWait(d time.Duration)\n}\n",
+		})
+		tmpl, err := ParseTemplate(tt.name, tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := Options{Targets: []string{"Timer"}, Package: "fake", Assert: true, Template: tmpl}
+		code := generate(t, dir, "fake/fake_timer.go", opts)
+		vet(t, dir)
+		for _, s := range tt.imported {
+			if !strings.Contains(code, s) {
+				t.Errorf("%s: expected import %s in\n%s", tt.name, s, code)
+			}
+		}
+		for _, s := range tt.unimported {
+			if strings.Contains(code, s) {
+				t.Errorf("%s: expected no import %s in\n%s", tt.name, s, code)
+			}
+		}
+	}
+}
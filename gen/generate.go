@@ -0,0 +1,632 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/y0za/interfake/model"
+)
+
+type Generator struct {
+	buf *bytes.Buffer
+	pt  model.PackageTable
+
+	// Mode is the kind of the generated implementation.
+	Mode Mode
+	// Unset is the behavior of a fake method whose func field is not set.
+	Unset UnsetMode
+	// Assert emits a compile-time assertion that the generated type implements the interface.
+	Assert bool
+	// Constructor emits NewFakeX constructors in ModeFake.
+	Constructor bool
+	// Template generates the implementation of each interface instead of
+	// the built-in one of Mode if set. It must be parsed by ParseTemplate.
+	Template *template.Template
+	// TypeName is the pattern of the name of the generated type, in which <Interface>
+	// is replaced with the interface name. It is Fake<Interface>, Mock<Interface>
+	// or Spy<Interface> by Mode if empty.
+	TypeName string
+	// TypeNames overrides the name of the generated type by the interface name.
+	TypeNames map[string]string
+	// FieldName is the pattern of the name of the func field handling a method,
+	// in which <Method> is replaced with the method name. It is Fake<Method> if empty.
+	FieldName string
+
+	imports model.PackagePathSet // packages imported by the template, recorded if not nil
+	used    model.PackagePathSet // packages of the types printed by the template, recorded if not nil
+}
+
+// Mode is the kind of the generated implementation.
+type Mode int
+
+const (
+	// ModeFake generates FakeX stubs driven by func fields.
+	ModeFake Mode = iota
+	// ModeMock generates MockX verifying expected calls with testing.TB.
+	ModeMock
+	// ModeSpy generates SpyX recording calls delegated to a real implementation.
+	ModeSpy
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeMock:
+		return "mock"
+	case ModeSpy:
+		return "spy"
+	}
+	return "fake"
+}
+
+// ParseMode returns the Mode of the name "fake", "mock" or "spy".
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "", "fake":
+		return ModeFake, nil
+	case "mock":
+		return ModeMock, nil
+	case "spy":
+		return ModeSpy, nil
+	}
+	return ModeFake, fmt.Errorf("unknown mode %q", name)
+}
+
+// UnsetMode is the behavior of a fake method whose func field is not set.
+type UnsetMode int
+
+const (
+	// UnsetNil calls the nil func, which panics with a runtime error.
+	UnsetNil UnsetMode = iota
+	// UnsetZero returns zero values for every result.
+	UnsetZero
+	// UnsetStrict panics with a message naming the interface and method.
+	UnsetStrict
+)
+
+func (u UnsetMode) String() string {
+	switch u {
+	case UnsetZero:
+		return "zero"
+	case UnsetStrict:
+		return "strict"
+	}
+	return "nil"
+}
+
+// ParseUnsetMode returns the UnsetMode of the name "nil", "zero" or "strict".
+func ParseUnsetMode(name string) (UnsetMode, error) {
+	switch name {
+	case "", "nil":
+		return UnsetNil, nil
+	case "zero":
+		return UnsetZero, nil
+	case "strict":
+		return UnsetStrict, nil
+	}
+	return UnsetNil, fmt.Errorf("unknown unset mode %q", name)
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		buf:    bytes.NewBufferString(""),
+		Assert: true,
+	}
+}
+
+func (g *Generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format+"\n", args...)
+}
+
+// Generate generates fake implementations of intfs into a single file
+// sharing one import block.
+func (g *Generator) Generate(intfs []*model.Interface, pkgName string, outputPackagePath string) error {
+	g.p("// This code is generated by github.com/y0za/interfake. DO NOT EDIT.")
+	g.p("package %v", pkgName)
+
+	for _, intf := range intfs {
+		if name := g.typeName(intf); !token.IsIdentifier(name) {
+			return fmt.Errorf("invalid type name %q of the interface %s", name, intf.Name)
+		}
+		for _, m := range intf.Methods {
+			if name := g.funcFieldName(m); !token.IsIdentifier(name) {
+				return fmt.Errorf("invalid field name %q of the method %s.%s", name, intf.Name, m.Name)
+			}
+		}
+	}
+
+	tmpl, err := g.template()
+	if err != nil {
+		return err
+	}
+
+	pps := make(model.PackagePathSet)
+	// packages referred by the generated code itself
+	runtime := model.PackagePathSet{"sync": struct{}{}}
+	for _, intf := range intfs {
+		for path := range intf.PackagePaths() {
+			pps[path] = struct{}{}
+		}
+		switch {
+		case g.Template == nil && g.Mode == ModeSpy:
+			if !referable(intf, outputPackagePath) {
+				return fmt.Errorf("interface %s wrapped by the spy can't be referred from the output package", intf.Name)
+			}
+		case tmpl != nil:
+			// imported by the template itself
+		case g.Mode == ModeMock:
+			runtime["testing"] = struct{}{}
+			for _, m := range intf.Methods {
+				if len(m.Args) > 0 {
+					// matching arguments of expected calls
+					runtime["reflect"] = struct{}{}
+				}
+			}
+		}
+		if g.assertable(intf, outputPackagePath) {
+			pps[intf.Package] = struct{}{}
+		}
+	}
+	delete(pps, outputPackagePath)
+
+	if tmpl != nil {
+		// only the packages printed by the template
+		runtime, pps, err = g.templateImports(tmpl, intfs, outputPackagePath, pps)
+		if err != nil {
+			return err
+		}
+		delete(pps, outputPackagePath)
+	}
+
+	var aliased map[string]bool
+	g.pt, aliased = newPackageTable(runtime, pps)
+	// types in the output package are not qualified
+	g.pt[outputPackagePath] = ""
+
+	g.p("")
+	g.p("import (")
+	for _, path := range sortedPackagePaths(runtime, pps) {
+		if aliased[path] {
+			g.p(`%s "%s"`, g.pt[path], path)
+		} else {
+			g.p(`"%s"`, path)
+		}
+	}
+	g.p(")")
+
+	for _, intf := range intfs {
+		if tmpl != nil {
+			err = tmpl.Execute(g.buf, g.templateData(intf, outputPackagePath))
+			if err != nil {
+				return fmt.Errorf("failed executing template: %v", err)
+			}
+			continue
+		}
+
+		err = g.generateMockImpl(intf)
+		if err != nil {
+			return err
+		}
+		if g.assertable(intf, outputPackagePath) {
+			g.generateAssertion(intf)
+		}
+	}
+
+	// interfaces declared in the output package share its scope
+	var declared []string
+	for _, intf := range intfs {
+		if intf.Package == outputPackagePath {
+			declared = append(declared, intf.Name)
+		}
+	}
+	return g.checkClashes(declared)
+}
+
+// typeName returns the name of the generated type implementing intf.
+func (g *Generator) typeName(intf *model.Interface) string {
+	if name, ok := g.TypeNames[intf.Name]; ok {
+		return name
+	}
+	pattern := g.TypeName
+	if pattern == "" {
+		switch g.Mode {
+		case ModeMock:
+			pattern = "Mock<Interface>"
+		case ModeSpy:
+			pattern = "Spy<Interface>"
+		default:
+			pattern = "Fake<Interface>"
+		}
+	}
+	return strings.ReplaceAll(pattern, "<Interface>", intf.Name)
+}
+
+// funcFieldName returns the name of the func field handling the method m.
+func (g *Generator) funcFieldName(m *model.Method) string {
+	pattern := g.FieldName
+	if pattern == "" {
+		pattern = "Fake<Method>"
+	}
+	return strings.ReplaceAll(pattern, "<Method>", m.Name)
+}
+
+// checkClashes reports identifiers declared more than once in the generated code,
+// such as a method of the interface and a field or helper method of the generated type.
+// declared are the names already declared in the output package.
+func (g *Generator) checkClashes(declared []string) error {
+	file, err := parser.ParseFile(token.NewFileSet(), "", g.buf.Bytes(), 0)
+	if err != nil {
+		return fmt.Errorf("failed parsing generated code: %v", err)
+	}
+
+	var errs errorList
+	scope := make(map[string]bool)              // package scope
+	members := make(map[string]map[string]bool) // type name => field and method names
+	clashed := make(map[string]bool)            // type names declared more than once
+	declare := func(scope map[string]bool, name, desc string) bool {
+		if name == "_" {
+			return true
+		}
+		if scope[name] {
+			errs = append(errs, fmt.Errorf("name clash in generated code: %s is declared more than once", desc))
+			return false
+		}
+		scope[name] = true
+		return true
+	}
+	memberScope := func(typeName string) map[string]bool {
+		if members[typeName] == nil {
+			members[typeName] = make(map[string]bool)
+		}
+		return members[typeName]
+	}
+
+	for _, name := range declared {
+		scope[name] = true
+	}
+	for _, name := range g.pt {
+		if name != "" {
+			scope[name] = true
+		}
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if !declare(scope, s.Name.Name, s.Name.Name) {
+						// members of the type clash as well
+						clashed[s.Name.Name] = true
+						continue
+					}
+					st, ok := s.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, f := range st.Fields.List {
+						for _, n := range f.Names {
+							declare(memberScope(s.Name.Name), n.Name, s.Name.Name+"."+n.Name)
+						}
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						declare(scope, n.Name, n.Name)
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				declare(scope, d.Name.Name, d.Name.Name)
+				continue
+			}
+			recv := receiverTypeName(d.Recv.List[0].Type)
+			if clashed[recv] {
+				continue
+			}
+			declare(memberScope(recv), d.Name.Name, recv+"."+d.Name.Name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// receiverTypeName returns the name of the type of the receiver typ such as "*T[K, V]".
+func receiverTypeName(typ ast.Expr) string {
+	for {
+		switch v := typ.(type) {
+		case *ast.StarExpr:
+			typ = v.X
+		case *ast.IndexExpr:
+			typ = v.X
+		case *ast.IndexListExpr:
+			typ = v.X
+		case *ast.Ident:
+			return v.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// assertable reports whether to assert the generated type implements intf
+// in the package outputPackagePath.
+func (g *Generator) assertable(intf *model.Interface, outputPackagePath string) bool {
+	return g.Assert && referable(intf, outputPackagePath)
+}
+
+// referable reports whether intf can be referred from the package outputPackagePath.
+func referable(intf *model.Interface, outputPackagePath string) bool {
+	if intf.Package == "" {
+		return false
+	}
+	if intf.Package == outputPackagePath {
+		return true
+	}
+	// neither commands nor external test packages can be imported
+	return ast.IsExported(intf.Name) && intf.PackageName != "main" && !strings.HasSuffix(intf.Package, "_test")
+}
+
+// generateAssertion generates the compile-time assertion that the generated type implements intf.
+func (g *Generator) generateAssertion(intf *model.Interface) {
+	name := g.typeName(intf)
+	tas := intf.TypeArgsString()
+	it := (&model.NamedType{Package: intf.Package, Type: intf.Name}).String(g.pt) + tas
+
+	g.p("")
+	if len(intf.TypeParams) == 0 {
+		g.p("var _ %s = (*%s)(nil)", it, name)
+		return
+	}
+	// generic types can be asserted only inside a generic function
+	g.p("func _%s() {", intf.TypeParamsString(g.pt))
+	g.p("var _ %s = (*%s%s)(nil)", it, name, tas)
+	g.p("}")
+}
+
+// newPackageTable names the packages of runtime and pps without collisions.
+// Packages of runtime are named first so that the generated code can refer
+// them by their own names. It also returns the set of package paths
+// which need an alias in the import declaration.
+func newPackageTable(runtime, pps model.PackagePathSet) (model.PackageTable, map[string]bool) {
+	pt := make(model.PackageTable)
+	aliased := make(map[string]bool)
+	used := make(map[string]bool)
+
+	for _, set := range []model.PackagePathSet{runtime, pps} {
+		for _, path := range sortedPackagePaths(set) {
+			if _, ok := pt[path]; ok {
+				continue
+			}
+			name, certain := packageName(path)
+			alias := name
+			for i := 1; used[alias] || token.IsKeyword(alias); i++ {
+				alias = fmt.Sprintf("%s%d", name, i)
+			}
+			used[alias] = true
+			pt[path] = alias
+			if !certain || alias != name {
+				aliased[path] = true
+			}
+		}
+	}
+
+	return pt, aliased
+}
+
+// sortedPackagePaths returns the union of package paths of sets in order.
+func sortedPackagePaths(sets ...model.PackagePathSet) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, set := range sets {
+		for path := range set {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// packageName returns the name of the package path. If the package can't be found,
+// the name is guessed from the path and certain is false.
+func packageName(path string) (name string, certain bool) {
+	if pkg, err := build.Import(path, "", build.ImportComment); err == nil && pkg.Name != "" {
+		return pkg.Name, true
+	}
+
+	elems := strings.Split(path, "/")
+	last := elems[len(elems)-1]
+	// major version suffix of modules such as example.com/foo/v2
+	if len(elems) > 1 && isMajorVersion(last) {
+		last = elems[len(elems)-2]
+	}
+	// gopkg.in/yaml.v2
+	last = strings.SplitN(last, ".", 2)[0]
+	last = strings.TrimPrefix(last, "go-")
+	last = strings.TrimSuffix(last, "-go")
+
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, last)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "pkg" + name
+	}
+	return name, false
+}
+
+// isMajorVersion reports whether elem is a major version suffix such as "v2".
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	for _, r := range elem[1:] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Generator) Format() error {
+	formatted := &bytes.Buffer{}
+	fs := token.NewFileSet()
+
+	node, err := parser.ParseFile(fs, "", g.buf, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("failed parsing generated code: %v", err)
+	}
+
+	err = format.Node(formatted, fs, node)
+	if err != nil {
+		return fmt.Errorf("failed formatting generated code: %v", err)
+	}
+
+	g.buf = formatted
+	return nil
+}
+
+func (g *Generator) WriteTo(w io.Writer) (int64, error) {
+	return g.buf.WriteTo(w)
+}
+
+// callTypeName returns the name of the type recording a call of the method m.
+// typeName is the name of the generated type implementing the interface.
+func callTypeName(typeName string, m *model.Method) string {
+	return typeName + m.Name + "Call"
+}
+
+// callsFieldName returns the name of the field holding recorded calls of the method m.
+// It differs from the accessor <Method>Calls even if m is unexported.
+func callsFieldName(m *model.Method) string {
+	return strings.ToLower(m.Name[:1]) + m.Name[1:] + "CallRecords"
+}
+
+// resultsTypeName returns the name of the type holding canned results of the method m.
+// typeName is the name of the generated type implementing the interface.
+func resultsTypeName(typeName string, m *model.Method) string {
+	return typeName + m.Name + "Results"
+}
+
+// returnsFieldName returns the name of the field holding canned results of the method m.
+// It and the names suffixed with OnCall and Sequence differ from the accessors
+// <Method>Returns, <Method>ReturnsOnCall and <Method>ReturnsSequence even if m is unexported.
+func returnsFieldName(m *model.Method) string {
+	return strings.ToLower(m.Name[:1]) + m.Name[1:] + "Canned"
+}
+
+// storedTypeString returns the type of the parameter p as a value,
+// which is a slice if p is variadic.
+func storedTypeString(p *model.Parameter, pt model.PackageTable) string {
+	if p.Variadic {
+		return "[]" + p.Type.String(pt)
+	}
+	return p.Type.String(pt)
+}
+
+// methodScope holds the identifiers used in a generated method,
+// so that receivers, arguments and local variables shadow neither
+// each other nor the packages, type parameters and builtins the method refers.
+type methodScope map[string]bool
+
+// builtins are the predeclared identifiers referred by generated methods.
+var builtins = []string{"append", "len", "make", "new", "panic", "true", "false", "nil"}
+
+func (g *Generator) newMethodScope(intf *model.Interface) methodScope {
+	s := make(methodScope)
+	for _, name := range g.pt {
+		if name != "" {
+			s[name] = true
+		}
+	}
+	for _, tp := range intf.TypeParams {
+		s[tp.Name] = true
+	}
+	for _, name := range builtins {
+		s[name] = true
+	}
+	return s
+}
+
+// name returns an unused identifier based on base and marks it used.
+func (s methodScope) name(base string) string {
+	name := base
+	for i := 1; s[name] || token.IsKeyword(name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	s[name] = true
+	return name
+}
+
+// args returns copies of params renamed to unused identifiers.
+func (s methodScope) args(params []*model.Parameter) []*model.Parameter {
+	renamed := make([]*model.Parameter, len(params))
+	for i, p := range params {
+		renamed[i] = &model.Parameter{
+			Name:     s.name(argName(p, i)),
+			Type:     p.Type,
+			Variadic: p.Variadic,
+		}
+	}
+	return renamed
+}
+
+// argName returns the name of the i-th argument p,
+// which is named by its position if p is unnamed.
+func argName(p *model.Parameter, i int) string {
+	if p.Name == "" || p.Name == "_" {
+		return fmt.Sprintf("a%d", i)
+	}
+	return p.Name
+}
+
+func formalArgsString(params []*model.Parameter, pt model.PackageTable) string {
+	args := make([]string, len(params))
+	for i, p := range params {
+		args[i] = fmt.Sprintf("%s %s", argName(p, i), p.TypeString(pt))
+	}
+	return strings.Join(args, ", ")
+}
+
+func actualArgsString(params []*model.Parameter) string {
+	args := make([]string, len(params))
+	for i, p := range params {
+		name := argName(p, i)
+		if p.Variadic {
+			name += "..."
+		}
+		args[i] = name
+	}
+	return strings.Join(args, ", ")
+}
+
+func resultsString(params []*model.Parameter, pt model.PackageTable) string {
+	results := make([]string, len(params))
+	for i, p := range params {
+		results[i] = p.Type.String(pt)
+	}
+	resultsStr := strings.Join(results, ", ")
+	if rc := len(params); rc == 1 {
+		resultsStr = " " + resultsStr
+	} else if rc > 1 {
+		resultsStr = " (" + resultsStr + ")"
+	}
+	return resultsStr
+}
@@ -0,0 +1,225 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/y0za/interfake/model"
+)
+
+// generateMockImpl generates MockX, which fails the test on unexpected calls
+// and, at cleanup, on expected calls which were not made.
+func (g *Generator) generateMockImpl(intf *model.Interface) error {
+	name := g.typeName(intf)
+	tps := intf.TypeParamsString(g.pt)
+	tas := intf.TypeArgsString()
+
+	g.p("")
+	g.p("// %s is a mock of %s verifying expected calls.", name, intf.Name)
+	g.p("type %s%s struct {", name, tps)
+	g.p("t testing.TB")
+	g.p("mu sync.Mutex")
+	for _, m := range intf.Methods {
+		g.p("%s []*%s%s", expectationsFieldName(m), expectationTypeName(name, m), tas)
+	}
+	g.p("}")
+
+	g.p("")
+	g.p("// New%s returns a %s which verifies its expectations at the cleanup of t.", name, name)
+	g.p("func New%s%s(t testing.TB) *%s%s {", name, tps, name, tas)
+	g.p("m := &%s%s{t: t}", name, tas)
+	g.p("t.Cleanup(m.verify)")
+	g.p("return m")
+	g.p("}")
+
+	for _, m := range intf.Methods {
+		g.generateExpectation(intf, m)
+		g.generateMockMethod(intf, m)
+	}
+
+	g.p("")
+	g.p("func (m *%s%s) verify() {", name, tas)
+	g.p("m.t.Helper()")
+	g.p("m.mu.Lock()")
+	g.p("defer m.mu.Unlock()")
+	for _, m := range intf.Methods {
+		g.p("for _, e := range m.%s {", expectationsFieldName(m))
+		g.p("if e.calls < e.min {")
+		g.p(`m.t.Errorf("interfake: missing call of %s.%s: expected %%d times, called %%d times", e.min, e.calls)`, intf.Name, m.Name)
+		g.p("}")
+		g.p("}")
+	}
+	g.p("}")
+
+	return nil
+}
+
+// generateExpectation generates the type of an expected call of the method m
+// and the method registering it.
+func (g *Generator) generateExpectation(intf *model.Interface, m *model.Method) {
+	typeName := g.typeName(intf)
+	name := expectationTypeName(typeName, m)
+	tas := intf.TypeArgsString()
+	s := g.newMethodScope(intf)
+	want := s.args(m.Args)
+	got := make([]*model.Parameter, len(m.Args))
+	for i, a := range m.Args {
+		got[i] = &model.Parameter{Name: fmt.Sprintf("v%d", i), Type: a.Type, Variadic: a.Variadic}
+	}
+	got = s.args(got)
+	mock, e := s.name("m"), s.name("e")
+
+	matchType := (&model.FuncType{Args: m.Args, Results: []*model.Parameter{{Type: model.PredeclaredType("bool")}}}).String(g.pt)
+	doType := (&model.FuncType{Args: m.Args, Results: m.Results}).String(g.pt)
+
+	g.p("")
+	g.p("// %s is an expected call of %s.", name, m.Name)
+	g.p("type %s%s struct {", name, intf.TypeParamsString(g.pt))
+	g.p("match %s", matchType)
+	g.p("do %s", doType)
+	for i, r := range m.Results {
+		g.p("r%d %s", i, r.Type.String(g.pt))
+	}
+	g.p("min, max int // max < 0 means unlimited")
+	g.p("calls int")
+	g.p("}")
+
+	g.p("")
+	g.p("// Expect%s expects a call of %s with arguments deeply equal to the given ones.", m.Name, m.Name)
+	g.p("// It is expected once unless Times or AnyTimes is set.")
+	g.p("func (%s *%s%s) Expect%s(%s) *%s%s {", mock, typeName, tas, m.Name, formalArgsString(want, g.pt), name, tas)
+	g.p("%s.mu.Lock()", mock)
+	g.p("defer %s.mu.Unlock()", mock)
+	g.p("%s := &%s%s{min: 1, max: 1}", e, name, tas)
+	g.p("%s.match = func(%s) bool {", e, formalArgsString(got, g.pt))
+	conds := []string{"true"}
+	if len(m.Args) > 0 {
+		conds = make([]string, len(m.Args))
+		for i := range m.Args {
+			conds[i] = fmt.Sprintf("reflect.DeepEqual(%s, %s)", got[i].Name, want[i].Name)
+		}
+	}
+	g.p("return %s", strings.Join(conds, " && "))
+	g.p("}")
+	g.p("%s.%s = append(%s.%s, %s)", mock, expectationsFieldName(m), mock, expectationsFieldName(m), e)
+	g.p("return %s", e)
+	g.p("}")
+
+	recv := fmt.Sprintf("e *%s%s", name, tas)
+
+	g.p("")
+	g.p("// Match replaces the argument matching of the expected call with fn.")
+	g.p("func (%s) Match(fn %s) *%s%s {", recv, matchType, name, tas)
+	g.p("e.match = fn")
+	g.p("return e")
+	g.p("}")
+
+	g.p("")
+	g.p("// Times expects the call exactly n times.")
+	g.p("func (%s) Times(n int) *%s%s {", recv, name, tas)
+	g.p("e.min, e.max = n, n")
+	g.p("return e")
+	g.p("}")
+
+	g.p("")
+	g.p("// AnyTimes allows the call any number of times, including zero.")
+	g.p("func (%s) AnyTimes() *%s%s {", recv, name, tas)
+	g.p("e.min, e.max = 0, -1")
+	g.p("return e")
+	g.p("}")
+
+	g.p("")
+	g.p("// Do makes the expected call run fn and return its results.")
+	g.p("func (%s) Do(fn %s) *%s%s {", recv, doType, name, tas)
+	g.p("e.do = fn")
+	g.p("return e")
+	g.p("}")
+
+	if len(m.Results) > 0 {
+		params := make([]string, len(m.Results))
+		assigns := make([]string, len(m.Results))
+		for i, r := range m.Results {
+			params[i] = fmt.Sprintf("r%d %s", i, r.Type.String(g.pt))
+			assigns[i] = fmt.Sprintf("e.r%d = r%d", i, i)
+		}
+
+		g.p("")
+		g.p("// Returns makes the expected call return the given results.")
+		g.p("func (%s) Returns(%s) *%s%s {", recv, strings.Join(params, ", "), name, tas)
+		for _, a := range assigns {
+			g.p(a)
+		}
+		g.p("return e")
+		g.p("}")
+	}
+}
+
+// generateMockMethod generates the method m of the mock.
+func (g *Generator) generateMockMethod(intf *model.Interface, m *model.Method) {
+	typeName := g.typeName(intf)
+	tas := intf.TypeArgsString()
+	s := g.newMethodScope(intf)
+	args := s.args(m.Args)
+	mock, e, c := s.name("m"), s.name("e"), s.name("c")
+	aa := actualArgsString(args)
+
+	names := make([]string, len(args))
+	verbs := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.Name
+		verbs[i] = "%v"
+	}
+	zeros := make([]string, len(m.Results))
+	rets := make([]string, len(m.Results))
+	for i, r := range m.Results {
+		zeros[i] = model.ZeroValue(r.Type, g.pt)
+		rets[i] = fmt.Sprintf("%s.r%d", e, i)
+	}
+
+	g.p("")
+	g.p("func (%s *%s%s) %s(%s)%s {", mock, typeName, tas, m.Name, formalArgsString(args, g.pt), resultsString(m.Results, g.pt))
+	g.p("%s.t.Helper()", mock)
+	g.p("%s.mu.Lock()", mock)
+	g.p("var %s *%s%s", e, expectationTypeName(typeName, m), tas)
+	g.p("for _, %s := range %s.%s {", c, mock, expectationsFieldName(m))
+	g.p("if (%s.max < 0 || %s.calls < %s.max) && %s.match(%s) {", c, c, c, c, aa)
+	g.p("%s = %s", e, c)
+	g.p("break")
+	g.p("}")
+	g.p("}")
+	g.p("if %s != nil {", e)
+	g.p("%s.calls++", e)
+	g.p("}")
+	g.p("%s.mu.Unlock()", mock)
+	g.p("if %s == nil {", e)
+	if len(m.Args) > 0 {
+		g.p(`%s.t.Errorf("interfake: unexpected call of %s.%s(%s)", %s)`, mock, intf.Name, m.Name, strings.Join(verbs, ", "), strings.Join(names, ", "))
+	} else {
+		g.p(`%s.t.Errorf("interfake: unexpected call of %s.%s()")`, mock, intf.Name, m.Name)
+	}
+	g.p("return %s", strings.Join(zeros, ", "))
+	g.p("}")
+	g.p("if %s.do != nil {", e)
+	if len(m.Results) > 0 {
+		g.p("return %s.do(%s)", e, aa)
+	} else {
+		g.p("%s.do(%s)", e, aa)
+		g.p("return")
+	}
+	g.p("}")
+	if len(m.Results) > 0 {
+		g.p("return %s", strings.Join(rets, ", "))
+	}
+	g.p("}")
+}
+
+// expectationTypeName returns the name of the type of an expected call of the method m.
+// typeName is the name of the generated type implementing the interface.
+func expectationTypeName(typeName string, m *model.Method) string {
+	return typeName + m.Name + "Expectation"
+}
+
+// expectationsFieldName returns the name of the field holding expected calls of the method m.
+func expectationsFieldName(m *model.Method) string {
+	return strings.ToLower(m.Name[:1]) + m.Name[1:] + "Expectations"
+}
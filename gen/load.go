@@ -0,0 +1,413 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+
+	"github.com/y0za/interfake/model"
+)
+
+// typesLoader builds model.Interface from type-checked packages
+// instead of guessing from the syntax tree.
+type typesLoader struct {
+	pkg *types.Package
+}
+
+// loadPackageDir type-checks the package in the directory dir and
+// returns its interfaces. Imported packages are type-checked from source,
+// so it works offline using GOPATH, the module cache or the vendor directory.
+func loadPackageDir(dir string, opts sourceOptions) ([]*model.GoFile, error) {
+	bp, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing directory %s: %v", dir, err)
+	}
+
+	var names []string
+	names = append(names, bp.GoFiles...)
+	names = append(names, bp.CgoFiles...)
+	names = prefixFilesDir(dir, names)
+
+	return loadFiles(names, nil, importPathOfDir(bp, dir), opts)
+}
+
+// loadPackage type-checks the package importPath located
+// by the build context relative to srcDir and returns its interfaces.
+func loadPackage(importPath, srcDir string, opts sourceOptions) ([]*model.GoFile, error) {
+	bp, err := build.Import(importPath, srcDir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing package %s: %v", importPath, err)
+	}
+
+	var names []string
+	names = append(names, bp.GoFiles...)
+	names = append(names, bp.CgoFiles...)
+	names = prefixFilesDir(bp.Dir, names)
+
+	return loadFiles(names, nil, bp.ImportPath, opts)
+}
+
+// loadSourceFile type-checks the package of the file name with the other files
+// of the package, and returns the interfaces declared in the file.
+// Test files are checked with the package under test or the other external test files.
+func loadSourceFile(name string, opts sourceOptions) ([]*model.GoFile, error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	bp, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			return nil, fmt.Errorf("failed importing directory %s: %v", dir, err)
+		}
+	}
+
+	var deps []string
+	switch {
+	case contains(bp.XTestGoFiles, base):
+		deps = bp.XTestGoFiles
+	case contains(bp.TestGoFiles, base):
+		deps = append(deps, bp.GoFiles...)
+		deps = append(deps, bp.CgoFiles...)
+		deps = append(deps, bp.TestGoFiles...)
+	case contains(bp.GoFiles, base) || contains(bp.CgoFiles, base):
+		deps = append(deps, bp.GoFiles...)
+		deps = append(deps, bp.CgoFiles...)
+	}
+
+	var others []string
+	for _, dep := range deps {
+		if dep != base {
+			others = append(others, dep)
+		}
+	}
+	return loadFiles([]string{name}, prefixFilesDir(dir, others), PackagePath(name), opts)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFiles type-checks the files names of the package pkgPath with the other
+// files deps of the package, and returns the interfaces declared in names.
+// If opts.allErrors is set, it reports every syntax and type error
+// as an errorList instead of stopping at the first one.
+// Interfaces failed to load are skipped unless they are opts.targets.
+func loadFiles(names, deps []string, pkgPath string, opts sourceOptions) ([]*model.GoFile, error) {
+	fs := token.NewFileSet()
+
+	var mode parser.Mode
+	if opts.allErrors {
+		mode = parser.AllErrors
+	}
+
+	var errs errorList
+	var files []*ast.File
+	for _, name := range append(names[:len(names):len(names)], deps...) {
+		file, err := parser.ParseFile(fs, name, nil, mode)
+		if err != nil {
+			if !opts.allErrors {
+				return nil, err
+			}
+			errs.add(err)
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fs, "source", nil),
+	}
+	if opts.allErrors {
+		conf.Error = func(err error) { errs.add(err) }
+	}
+	pkgPath = testPackagePath(files, pkgPath)
+	pkg, err := conf.Check(pkgPath, fs, files, nil)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l := typesLoader{pkg: pkg}
+
+	var goFiles []*model.GoFile
+	for _, file := range files[:len(names)] {
+		var is []*model.Interface
+		for _, ni := range interfacesOfFile(file) {
+			tn, ok := pkg.Scope().Lookup(ni.name.Name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			it, ok := tn.Type().Underlying().(*types.Interface)
+			if !ok || !it.IsMethodSet() {
+				// constraint interfaces cannot be implemented by a fake
+				continue
+			}
+			i, err := l.loadInterface(tn, it)
+			if err != nil {
+				err = fmt.Errorf("%s: %v", fs.Position(ni.name.Pos()), err)
+				if opts.skip(ni.name.Name, err) {
+					continue
+				}
+				if !opts.allErrors {
+					return nil, err
+				}
+				errs.add(err)
+				continue
+			}
+			is = append(is, i)
+		}
+
+		goFiles = append(goFiles, &model.GoFile{
+			PackageName: pkg.Name(),
+			Interfaces:  is,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return goFiles, nil
+}
+
+func (l *typesLoader) loadInterface(tn *types.TypeName, it *types.Interface) (*model.Interface, error) {
+	intf := &model.Interface{Name: tn.Name(), Package: tn.Pkg().Path(), PackageName: tn.Pkg().Name()}
+
+	if named, ok := tn.Type().(*types.Named); ok {
+		tps := named.TypeParams()
+		for i := 0; i < tps.Len(); i++ {
+			tp := tps.At(i)
+			c, err := l.loadType(tp.Constraint())
+			if err != nil {
+				return nil, fmt.Errorf("failed loading type parameter constraint: %v", err)
+			}
+			intf.TypeParams = append(intf.TypeParams, &model.TypeParam{Name: tp.Obj().Name(), Constraint: c})
+		}
+	}
+
+	for i := 0; i < it.NumMethods(); i++ {
+		f := it.Method(i)
+		sig := f.Type().(*types.Signature)
+		args, results, err := l.loadSignature(sig)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading method %s: %v", f.Name(), err)
+		}
+		intf.Methods = append(intf.Methods, &model.Method{
+			Name:    f.Name(),
+			Args:    args,
+			Results: results,
+		})
+	}
+
+	return intf, nil
+}
+
+func (l *typesLoader) loadSignature(sig *types.Signature) (args []*model.Parameter, results []*model.Parameter, err error) {
+	args, err = l.loadTuple(sig.Params())
+	if err != nil {
+		return nil, nil, err
+	}
+	if sig.Variadic() {
+		last := args[len(args)-1]
+		last.Type = last.Type.(*model.SliceType).Type
+		last.Variadic = true
+	}
+	results, err = l.loadTuple(sig.Results())
+	if err != nil {
+		return nil, nil, err
+	}
+	return args, results, nil
+}
+
+func (l *typesLoader) loadTuple(tuple *types.Tuple) ([]*model.Parameter, error) {
+	var ps []*model.Parameter
+	for i := 0; i < tuple.Len(); i++ {
+		v := tuple.At(i)
+		t, err := l.loadType(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		name := v.Name()
+		if name == "_" {
+			name = ""
+		}
+		ps = append(ps, &model.Parameter{Name: name, Type: t})
+	}
+	return ps, nil
+}
+
+func (l *typesLoader) loadType(typ types.Type) (model.Type, error) {
+	switch v := typ.(type) {
+	case *types.Alias:
+		obj := v.Obj()
+		if obj.Pkg() == nil {
+			// predeclared alias such as any
+			return model.PredeclaredType(obj.Name()), nil
+		}
+		if !obj.Exported() && obj.Pkg() != l.pkg {
+			// unexported alias is not accessible, refer to the aliased type
+			return l.loadType(v.Rhs())
+		}
+		return l.loadTypeName(obj, v.TypeArgs())
+	case *types.Array:
+		t, err := l.loadType(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &model.ArrayType{Len: int(v.Len()), Type: t}, nil
+	case *types.Basic:
+		if v.Kind() == types.UnsafePointer {
+			return &model.NamedType{Package: "unsafe", Type: "Pointer"}, nil
+		}
+		return model.PredeclaredType(v.Name()), nil
+	case *types.Chan:
+		t, err := l.loadType(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		var dir model.ChanDir
+		if v.Dir() == types.SendOnly {
+			dir = model.SendDirection
+		}
+		if v.Dir() == types.RecvOnly {
+			dir = model.RecvDirection
+		}
+		return &model.ChanType{Direction: dir, Type: t}, nil
+	case *types.Interface:
+		if v.NumMethods() > 0 || v.NumEmbeddeds() > 0 {
+			if v.IsImplicit() && v.NumEmbeddeds() == 1 {
+				// constraint literal such as [T ~int | string]
+				return l.loadType(v.EmbeddedType(0))
+			}
+			return l.loadInterfaceLiteral(v)
+		}
+		return model.PredeclaredType("interface{}"), nil
+	case *types.Map:
+		key, err := l.loadType(v.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := l.loadType(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &model.MapType{Key: key, Value: value}, nil
+	case *types.Named:
+		obj := v.Obj()
+		if obj.Pkg() == nil {
+			// predeclared type such as error
+			return model.PredeclaredType(obj.Name()), nil
+		}
+		return l.loadTypeName(obj, v.TypeArgs())
+	case *types.Pointer:
+		t, err := l.loadType(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &model.PointerType{Type: t}, nil
+	case *types.Signature:
+		args, results, err := l.loadSignature(v)
+		if err != nil {
+			return nil, err
+		}
+		return &model.FuncType{Args: args, Results: results}, nil
+	case *types.Slice:
+		t, err := l.loadType(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &model.SliceType{Type: t}, nil
+	case *types.Struct:
+		if v.NumFields() > 0 {
+			return l.loadStruct(v)
+		}
+		return model.PredeclaredType("struct{}"), nil
+	case *types.TypeParam:
+		return &model.NamedType{Type: v.Obj().Name()}, nil
+	case *types.Union:
+		u := &model.UnionType{}
+		for i := 0; i < v.Len(); i++ {
+			term := v.Term(i)
+			t, err := l.loadType(term.Type())
+			if err != nil {
+				return nil, err
+			}
+			u.Terms = append(u.Terms, &model.Term{Tilde: term.Tilde(), Type: t})
+		}
+		return u, nil
+	}
+
+	return nil, fmt.Errorf("don't know how to load type %T", typ)
+}
+
+func (l *typesLoader) loadStruct(st *types.Struct) (model.Type, error) {
+	t := &model.StructType{}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		ft, err := l.loadType(f.Type())
+		if err != nil {
+			return nil, err
+		}
+		field := &model.Field{Type: ft, Tag: st.Tag(i), Embedded: f.Embedded()}
+		if !f.Embedded() {
+			field.Name = f.Name()
+		}
+		t.Fields = append(t.Fields, field)
+	}
+	return t, nil
+}
+
+// loadInterfaceLiteral loads the unnamed interface type it.
+// Embedded types are kept as they are, not flattened.
+func (l *typesLoader) loadInterfaceLiteral(it *types.Interface) (model.Type, error) {
+	t := &model.InterfaceLiteralType{}
+	for i := 0; i < it.NumEmbeddeds(); i++ {
+		et, err := l.loadType(it.EmbeddedType(i))
+		if err != nil {
+			return nil, err
+		}
+		t.Embedded = append(t.Embedded, et)
+	}
+	for i := 0; i < it.NumExplicitMethods(); i++ {
+		f := it.ExplicitMethod(i)
+		args, results, err := l.loadSignature(f.Type().(*types.Signature))
+		if err != nil {
+			return nil, fmt.Errorf("failed loading method %s: %v", f.Name(), err)
+		}
+		t.Methods = append(t.Methods, &model.Method{Name: f.Name(), Args: args, Results: results})
+	}
+	return t, nil
+}
+
+// loadTypeName returns the type declared by obj, instantiated with targs if any.
+func (l *typesLoader) loadTypeName(obj *types.TypeName, targs *types.TypeList) (model.Type, error) {
+	var t model.Type = &model.NamedType{Package: obj.Pkg().Path(), Type: obj.Name()}
+	if targs.Len() == 0 {
+		return t, nil
+	}
+
+	it := &model.InstantiatedType{Type: t}
+	for i := 0; i < targs.Len(); i++ {
+		arg, err := l.loadType(targs.At(i))
+		if err != nil {
+			return nil, err
+		}
+		it.TypeArgs = append(it.TypeArgs, arg)
+	}
+	return it, nil
+}
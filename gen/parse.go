@@ -0,0 +1,1154 @@
+// Copyright 2012 Google Inc.
+// https://github.com/golang/mock/blob/master/mockgen/model/parse.go
+// This file contains copies and modifications.
+// Originaly under the Apache License, Version 2.0.
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/y0za/interfake/model"
+)
+
+type fileParser struct {
+	fileSet    *token.FileSet
+	imports    map[string]string                    // package name => import path
+	dotImports []string                             // import paths imported with "."
+	interfaces map[string]map[string]namedInterface // package path => interface name => interface
+	exported   map[string]map[string]bool           // package path => exported type and constant names
+	packages   map[string][]*ast.File               // package path => parsed files
+	typeParams map[string]model.Type                // type parameter name => type in scope
+	srcDir     string
+	opts       sourceOptions
+	errs       errorList // errors collected if opts.allErrors
+}
+
+// sourceOptions controls how interfaces are read from source files.
+type sourceOptions struct {
+	allErrors bool     // collect errors instead of stopping at the first one
+	targets   []string // interfaces which must be supported, the others are skipped on errors
+	warn      func(error)
+}
+
+// required reports whether the interface name must be supported.
+func (o sourceOptions) required(name string) bool {
+	for _, t := range o.targets {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// skip reports err of the unsupported interface name as a warning
+// and reports whether the interface can be skipped.
+func (o sourceOptions) skip(name string, err error) bool {
+	if o.required(name) {
+		return false
+	}
+	if o.warn != nil {
+		o.warn(wrapf(err, "skipped interface %s", name))
+	}
+	return true
+}
+
+type namedInterface struct {
+	name       *ast.Ident
+	it         *ast.InterfaceType
+	typeParams *ast.FieldList    // may be nil
+	imports    map[string]string // imports of the file declaring the interface
+	dotImports []string
+}
+
+func parsePackageDir(dir string, opts sourceOptions) ([]*model.GoFile, error) {
+	pkg, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing directory %s: %v", dir, err)
+	}
+
+	var names []string
+	names = append(names, pkg.GoFiles...)
+	names = append(names, pkg.CgoFiles...)
+	names = prefixFilesDir(dir, names)
+
+	return parseFiles(names, importPathOfDir(pkg, dir), opts)
+}
+
+// parsePackage parses the package importPath located
+// by the build context relative to srcDir.
+func parsePackage(importPath, srcDir string, opts sourceOptions) ([]*model.GoFile, error) {
+	pkg, err := build.Import(importPath, srcDir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed importing package %s: %v", importPath, err)
+	}
+
+	var names []string
+	names = append(names, pkg.GoFiles...)
+	names = append(names, pkg.CgoFiles...)
+	names = prefixFilesDir(pkg.Dir, names)
+
+	return parseFiles(names, pkg.ImportPath, opts)
+}
+
+// testPackagePath returns the import path of the external test package
+// if files belong to it, otherwise pkg.
+func testPackagePath(files []*ast.File, pkg string) string {
+	if len(files) > 0 && strings.HasSuffix(files[0].Name.Name, "_test") && !strings.HasSuffix(pkg, "_test") {
+		return pkg + "_test"
+	}
+	return pkg
+}
+
+// importPathOfDir returns the import path of pkg found in dir.
+// build.ImportDir reports a local path such as "." outside GOPATH,
+// in which case the path is resolved from go.mod.
+func importPathOfDir(pkg *build.Package, dir string) string {
+	if !build.IsLocalImport(pkg.ImportPath) && !strings.HasPrefix(pkg.ImportPath, "_/") {
+		return pkg.ImportPath
+	}
+	if p := DirPackagePath(dir); p != "" {
+		return p
+	}
+	return pkg.ImportPath
+}
+
+// prefixFilesDir places the directory name on the beginning of each file name in the list.
+func prefixFilesDir(dir string, names []string) []string {
+	if dir == "." {
+		return names
+	}
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = filepath.Join(dir, name)
+	}
+	return ret
+}
+
+// parseFiles parses the files names of the package pkg.
+// If opts.allErrors is set, it reports every error found in the files
+// as an errorList instead of stopping at the first one.
+// Interfaces failed to parse are skipped unless they are opts.targets.
+func parseFiles(names []string, pkg string, opts sourceOptions) ([]*model.GoFile, error) {
+	p := fileParser{
+		fileSet:    token.NewFileSet(),
+		imports:    make(map[string]string),
+		interfaces: make(map[string]map[string]namedInterface),
+		exported:   make(map[string]map[string]bool),
+		packages:   make(map[string][]*ast.File),
+		opts:       opts,
+	}
+	if len(names) > 0 {
+		p.srcDir, _ = filepath.Abs(filepath.Dir(names[0]))
+	}
+
+	var mode parser.Mode
+	if opts.allErrors {
+		mode = parser.AllErrors
+	}
+
+	var files []*ast.File
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(p.fileSet, name, nil, mode)
+		if err != nil {
+			if err := p.fail(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		files = append(files, file)
+	}
+
+	pkg = testPackagePath(files, pkg)
+	// constants of the package may be evaluated
+	p.packages[pkg] = files
+
+	local, err := p.interfacesOfFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	p.interfaces[pkg] = local
+
+	var goFiles []*model.GoFile
+	for _, file := range files {
+		gf, err := p.parseFile(file, pkg)
+		if err != nil {
+			return nil, err
+		}
+
+		goFiles = append(goFiles, gf)
+	}
+
+	if len(p.errs) > 0 {
+		return nil, p.errs
+	}
+	return goFiles, nil
+}
+
+func (p *fileParser) parseFile(file *ast.File, pkg string) (*model.GoFile, error) {
+	// import errors are already reported by interfacesOfFiles
+	p.imports, _ = p.importsOfFile(file)
+	p.dotImports = dotImportsOfFile(file)
+
+	var is []*model.Interface
+	for _, ni := range interfacesOfFile(file) {
+		if isConstraintInterface(ni.it) {
+			// constraint interfaces cannot be implemented by a fake
+			continue
+		}
+		i, err := p.parseInterface(pkg, file.Name.Name, ni)
+		if err != nil {
+			if p.opts.skip(ni.name.Name, err) {
+				continue
+			}
+			if err := p.fail(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		is = append(is, i)
+	}
+
+	return &model.GoFile{
+		PackageName: file.Name.String(),
+		Interfaces:  is,
+	}, nil
+}
+
+func (p *fileParser) parseInterface(pkg, pkgName string, ni namedInterface) (*model.Interface, error) {
+	name := ni.name.String()
+
+	tps, err := p.parseTypeParams(pkg, ni.typeParams)
+	if err != nil {
+		return nil, err
+	}
+	p.typeParams = make(map[string]model.Type)
+	for _, tp := range tps {
+		p.typeParams[tp.Name] = &model.NamedType{Type: tp.Name}
+	}
+	defer func() { p.typeParams = nil }()
+
+	seen := map[string]bool{pkg + "." + name: true}
+	methods, err := p.parseMethods(pkg, ni.it, seen)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Interface{Name: name, Package: pkg, PackageName: pkgName, TypeParams: tps, Methods: methods}, nil
+}
+
+// parseTypeParams parses the type parameter list of a generic interface.
+// Type parameters are in scope of their own constraints.
+func (p *fileParser) parseTypeParams(pkg string, fl *ast.FieldList) ([]*model.TypeParam, error) {
+	if fl == nil {
+		return nil, nil
+	}
+
+	p.typeParams = make(map[string]model.Type)
+	for _, f := range fl.List {
+		for _, name := range f.Names {
+			p.typeParams[name.Name] = &model.NamedType{Type: name.Name}
+		}
+	}
+	defer func() { p.typeParams = nil }()
+
+	var tps []*model.TypeParam
+	for _, f := range fl.List {
+		c, err := p.parseType(pkg, f.Type)
+		if err != nil {
+			return nil, wrapf(err, "failed parsing type parameter constraint")
+		}
+		for _, name := range f.Names {
+			tps = append(tps, &model.TypeParam{Name: name.Name, Constraint: c})
+		}
+	}
+	return tps, nil
+}
+
+// parseMethods returns the method set of it, flattening embedded interfaces.
+// seen holds the interfaces being expanded, to detect embedding cycles.
+func (p *fileParser) parseMethods(pkg string, it *ast.InterfaceType, seen map[string]bool) ([]*model.Method, error) {
+	var methods []*model.Method
+	explicit := make(map[string]bool)
+
+	add := func(pos token.Pos, m *model.Method) error {
+		for _, em := range methods {
+			if em.Name != m.Name {
+				continue
+			}
+			// Methods of the same name may overlap if they are identical,
+			// explicitly declared ones are checked to be unique by the caller.
+			if !em.SameSignature(m) {
+				return p.errorf(pos, "duplicate method %s", m.Name)
+			}
+			return nil
+		}
+		methods = append(methods, m)
+		return nil
+	}
+
+	for _, field := range it.Methods.List {
+		switch v := field.Type.(type) {
+		case *ast.FuncType:
+			if nn := len(field.Names); nn != 1 {
+				return nil, p.errorf(field.Pos(), "expected one name for interface method, got %d", nn)
+			}
+			m := &model.Method{
+				Name: field.Names[0].String(),
+			}
+			if explicit[m.Name] {
+				return nil, p.errorf(field.Pos(), "duplicate method %s", m.Name)
+			}
+			var err error
+			m.Args, m.Results, err = p.parseFunc(pkg, v)
+			if err != nil {
+				return nil, err
+			}
+			if err := add(field.Pos(), m); err != nil {
+				return nil, err
+			}
+			explicit[m.Name] = true
+		case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+			ems, err := p.parseEmbedded(pkg, v, seen)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range ems {
+				if err := add(v.Pos(), m); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, p.errorf(field.Pos(), "don't know how to mock method of type %T", field.Type)
+		}
+	}
+	return methods, nil
+}
+
+// parseEmbedded returns the flattened methods of the interface referred by
+// the embedded field typ, which may be an instantiation of a generic interface.
+func (p *fileParser) parseEmbedded(pkg string, typ ast.Expr, seen map[string]bool) ([]*model.Method, error) {
+	var indices []ast.Expr
+	switch v := typ.(type) {
+	case *ast.IndexExpr:
+		typ, indices = v.X, []ast.Expr{v.Index}
+	case *ast.IndexListExpr:
+		typ, indices = v.X, v.Indices
+	}
+
+	var typeArgs []model.Type
+	for _, index := range indices {
+		t, err := p.parseType(pkg, index)
+		if err != nil {
+			return nil, err
+		}
+		typeArgs = append(typeArgs, t)
+	}
+
+	switch v := typ.(type) {
+	case *ast.Ident:
+		identPkg, err := p.identPackage(v.Pos(), pkg, v.Name)
+		if err != nil {
+			return nil, err
+		}
+		ms, err := p.parseEmbeddedInterface(v.Pos(), identPkg, v.Name, typeArgs, seen)
+		if err != nil {
+			return nil, wrapf(err, "failed embedding interface %s", v.Name)
+		}
+		return ms, nil
+	case *ast.SelectorExpr:
+		pkgIdent, ok := v.X.(*ast.Ident)
+		if !ok {
+			return nil, p.errorf(v.Pos(), "don't know how to embed %T", v.X)
+		}
+		embeddedPkg, ok := p.imports[pkgIdent.Name]
+		if !ok {
+			return nil, p.errorf(v.Pos(), "unknown package %q", pkgIdent.Name)
+		}
+		ms, err := p.parseEmbeddedInterface(v.Pos(), embeddedPkg, v.Sel.Name, typeArgs, seen)
+		if err != nil {
+			return nil, wrapf(err, "failed embedding interface %s.%s", pkgIdent.Name, v.Sel.Name)
+		}
+		return ms, nil
+	}
+	return nil, p.errorf(typ.Pos(), "don't know how to embed %T", typ)
+}
+
+// parseEmbeddedInterface returns the flattened methods of the interface name
+// declared in the package pkg, instantiated with typeArgs if it is generic.
+// pos is the position embedding the interface.
+func (p *fileParser) parseEmbeddedInterface(pos token.Pos, pkg, name string, typeArgs []model.Type, seen map[string]bool) ([]*model.Method, error) {
+	key := pkg + "." + name
+	if seen[key] {
+		return nil, p.errorf(pos, "interface %s embeds itself", name)
+	}
+
+	ni, err := p.lookupInterface(pos, pkg, name)
+	if err != nil {
+		if name == "error" {
+			// predeclared error interface
+			return []*model.Method{{
+				Name:    "Error",
+				Results: []*model.Parameter{{Type: model.PredeclaredType("string")}},
+			}}, nil
+		}
+		return nil, err
+	}
+
+	// Type parameters of the embedded interface are substituted with the type arguments.
+	typeParams := make(map[string]model.Type)
+	if ni.typeParams != nil {
+		for _, f := range ni.typeParams.List {
+			for _, n := range f.Names {
+				if len(typeParams) >= len(typeArgs) {
+					return nil, p.errorf(pos, "not enough type arguments for interface %s", name)
+				}
+				typeParams[n.Name] = typeArgs[len(typeParams)]
+			}
+		}
+	}
+	if len(typeParams) != len(typeArgs) {
+		return nil, p.errorf(pos, "got %d type arguments for interface %s with %d type parameters", len(typeArgs), name, len(typeParams))
+	}
+
+	seen[key] = true
+	defer delete(seen, key)
+
+	// Types in the embedded interface are resolved by the imports of its own file.
+	imports, dotImports, scope := p.imports, p.dotImports, p.typeParams
+	p.imports, p.dotImports, p.typeParams = ni.imports, ni.dotImports, typeParams
+	defer func() { p.imports, p.dotImports, p.typeParams = imports, dotImports, scope }()
+
+	return p.parseMethods(pkg, ni.it, seen)
+}
+
+// lookupInterface finds the interface name referred at pos in the package pkg,
+// parsing the package if it has not been loaded yet.
+func (p *fileParser) lookupInterface(pos token.Pos, pkg, name string) (namedInterface, error) {
+	is, ok := p.interfaces[pkg]
+	if !ok {
+		files, err := p.parseImportedPackage(pos, pkg)
+		if err != nil {
+			return namedInterface{}, err
+		}
+		is, err = p.interfacesOfFiles(files)
+		if err != nil {
+			return namedInterface{}, err
+		}
+		p.interfaces[pkg] = is
+	}
+
+	ni, ok := is[name]
+	if !ok {
+		return namedInterface{}, p.errorf(pos, "not found interface %s in package %s", name, pkg)
+	}
+	return ni, nil
+}
+
+// parseImportedPackage parses the files of the package importPath referred at pos.
+func (p *fileParser) parseImportedPackage(pos token.Pos, importPath string) ([]*ast.File, error) {
+	if files, ok := p.packages[importPath]; ok {
+		return files, nil
+	}
+
+	pkg, err := build.Import(importPath, p.srcDir, 0)
+	if err != nil {
+		return nil, p.errorf(pos, "failed importing package %s: %v", importPath, err)
+	}
+
+	var names []string
+	names = append(names, pkg.GoFiles...)
+	names = append(names, pkg.CgoFiles...)
+
+	var files []*ast.File
+	for _, name := range prefixFilesDir(pkg.Dir, names) {
+		file, err := parser.ParseFile(p.fileSet, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	p.packages[importPath] = files
+	return files, nil
+}
+
+// identPackage returns the package path of the exported identifier name
+// used at pos in the package pkg. The identifier belongs to a dot-imported package
+// if that package declares it, otherwise to pkg.
+func (p *fileParser) identPackage(pos token.Pos, pkg, name string) (string, error) {
+	if !ast.IsExported(name) {
+		return pkg, nil
+	}
+	return p.dotImportedPackage(pos, p.dotImports, name, pkg)
+}
+
+// dotImportedPackage returns the package path of dotImports which declares
+// the exported type or constant name used at pos, or def if none declares it.
+func (p *fileParser) dotImportedPackage(pos token.Pos, dotImports []string, name, def string) (string, error) {
+	for _, path := range dotImports {
+		exported, ok := p.exported[path]
+		if !ok {
+			files, err := p.parseImportedPackage(pos, path)
+			if err != nil {
+				return "", wrapf(err, "failed parsing dot-imported package %q", path)
+			}
+			exported = exportedNamesOfFiles(files)
+			p.exported[path] = exported
+		}
+		if exported[name] {
+			return path, nil
+		}
+	}
+	return def, nil
+}
+
+func (p *fileParser) parseFunc(pkg string, f *ast.FuncType) (args []*model.Parameter, results []*model.Parameter, err error) {
+	if f.Params != nil {
+		args, err = p.parseFieldList(pkg, f.Params.List)
+		if err != nil {
+			return nil, nil, wrapf(err, "failed parsing arguments")
+		}
+	}
+	if f.Results != nil {
+		results, err = p.parseFieldList(pkg, f.Results.List)
+		if err != nil {
+			return nil, nil, wrapf(err, "failed parsing results")
+		}
+	}
+	return
+}
+
+func (p *fileParser) parseFieldList(pkg string, fields []*ast.Field) ([]*model.Parameter, error) {
+	var ps []*model.Parameter
+	for i, f := range fields {
+		typ := f.Type
+		variadic := false
+		if e, ok := typ.(*ast.Ellipsis); ok {
+			if i != len(fields)-1 {
+				return nil, p.errorf(e.Pos(), "can only use ... with final parameter")
+			}
+			typ = e.Elt
+			variadic = true
+		}
+
+		t, err := p.parseType(pkg, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(f.Names) == 0 {
+			// anonymous arg
+			ps = append(ps, &model.Parameter{Type: t, Variadic: variadic})
+			continue
+		}
+		for _, name := range f.Names {
+			ps = append(ps, &model.Parameter{Name: name.Name, Type: t, Variadic: variadic})
+		}
+	}
+	return ps, nil
+}
+
+func (p *fileParser) parseType(pkg string, typ ast.Expr) (model.Type, error) {
+	switch v := typ.(type) {
+	case *ast.ArrayType:
+		t, err := p.parseType(pkg, v.Elt)
+		if err != nil {
+			return nil, err
+		}
+		if v.Len == nil {
+			return &model.SliceType{Type: t}, nil
+		}
+		at := &model.ArrayType{Type: t}
+		if lit, ok := v.Len.(*ast.BasicLit); ok && lit.Kind == token.INT {
+			x, err := strconv.ParseInt(lit.Value, 0, 0)
+			if err != nil {
+				return nil, p.errorf(v.Len.Pos(), "bad array size: %v", err)
+			}
+			at.Len = int(x)
+			return at, nil
+		}
+		// named constant or constant expression
+		at.LenExpr, err = p.parseConstExpr(pkg, v.Len)
+		if err != nil {
+			return nil, err
+		}
+		return at, nil
+	case *ast.ChanType:
+		t, err := p.parseType(pkg, v.Value)
+		if err != nil {
+			return nil, err
+		}
+		var dir model.ChanDir
+		if v.Dir == ast.SEND {
+			dir = model.SendDirection
+		}
+		if v.Dir == ast.RECV {
+			dir = model.RecvDirection
+		}
+		return &model.ChanType{Direction: dir, Type: t}, nil
+	case *ast.FuncType:
+		args, results, err := p.parseFunc(pkg, v)
+		if err != nil {
+			return nil, err
+		}
+		return &model.FuncType{Args: args, Results: results}, nil
+	case *ast.Ident:
+		if t, ok := p.typeParams[v.Name]; ok {
+			return t, nil
+		}
+		if v.IsExported() {
+			identPkg, err := p.identPackage(v.Pos(), pkg, v.Name)
+			if err != nil {
+				return nil, err
+			}
+			if identPkg != pkg {
+				// declared in a dot-imported package
+				return &model.NamedType{Package: identPkg, Type: v.Name}, nil
+			}
+			// `pkg` may be an aliased imported pkg
+			// if so, patch the import w/ the fully qualified import
+			maybeImportedPkg, ok := p.imports[pkg]
+			if ok {
+				pkg = maybeImportedPkg
+			}
+			// assume type in this package
+			return &model.NamedType{Package: pkg, Type: v.Name}, nil
+		} else {
+			// assume predeclared type
+			return model.PredeclaredType(v.Name), nil
+		}
+	case *ast.InterfaceType:
+		if v.Methods == nil || len(v.Methods.List) == 0 {
+			return model.PredeclaredType("interface{}"), nil
+		}
+		return p.parseInterfaceLiteral(pkg, v)
+	case *ast.MapType:
+		key, err := p.parseType(pkg, v.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.parseType(pkg, v.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &model.MapType{Key: key, Value: value}, nil
+	case *ast.SelectorExpr:
+		pkgIdent, ok := v.X.(*ast.Ident)
+		if !ok {
+			return nil, p.errorf(v.Pos(), "don't know how to parse type %T", v.X)
+		}
+		pkgName := pkgIdent.String()
+		pkg, ok := p.imports[pkgName]
+		if !ok {
+			return nil, p.errorf(v.Pos(), "unknown package %q", pkgName)
+		}
+		return &model.NamedType{Package: pkg, Type: v.Sel.String()}, nil
+	case *ast.IndexExpr:
+		return p.parseInstantiatedType(pkg, v.X, []ast.Expr{v.Index})
+	case *ast.IndexListExpr:
+		return p.parseInstantiatedType(pkg, v.X, v.Indices)
+	case *ast.BinaryExpr:
+		if v.Op != token.OR {
+			break
+		}
+		x, err := p.parseType(pkg, v.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := p.parseType(pkg, v.Y)
+		if err != nil {
+			return nil, err
+		}
+		u := &model.UnionType{}
+		u.Terms = append(u.Terms, unionTerms(x)...)
+		u.Terms = append(u.Terms, unionTerms(y)...)
+		return u, nil
+	case *ast.UnaryExpr:
+		if v.Op != token.TILDE {
+			break
+		}
+		t, err := p.parseType(pkg, v.X)
+		if err != nil {
+			return nil, err
+		}
+		return &model.UnionType{Terms: []*model.Term{{Tilde: true, Type: t}}}, nil
+	case *ast.ParenExpr:
+		return p.parseType(pkg, v.X)
+	case *ast.StarExpr:
+		t, err := p.parseType(pkg, v.X)
+		if err != nil {
+			return nil, err
+		}
+		return &model.PointerType{Type: t}, nil
+	case *ast.StructType:
+		if v.Fields == nil || len(v.Fields.List) == 0 {
+			return model.PredeclaredType("struct{}"), nil
+		}
+		return p.parseStruct(pkg, v)
+	}
+
+	return nil, p.errorf(typ.Pos(), "don't know how to parse type %T", typ)
+}
+
+// parseConstExpr parses the constant expression expr such as "2 * sha256.Size".
+func (p *fileParser) parseConstExpr(pkg string, expr ast.Expr) (*model.ConstExpr, error) {
+	ce := &model.ConstExpr{}
+	var b strings.Builder
+
+	var walk func(e ast.Expr) error
+	walk = func(e ast.Expr) error {
+		switch v := e.(type) {
+		case *ast.BasicLit:
+			b.WriteString(strings.ReplaceAll(v.Value, "%", "%%"))
+			return nil
+		case *ast.Ident:
+			if !v.IsExported() {
+				// unexported constants can't be referred from other packages
+				x, err := p.constValue(v.Pos(), pkg, v.Name, make(map[string]bool))
+				if err != nil {
+					return err
+				}
+				b.WriteString(x.ExactString())
+				return nil
+			}
+			identPkg, err := p.identPackage(v.Pos(), pkg, v.Name)
+			if err != nil {
+				return err
+			}
+			b.WriteString("%s")
+			ce.Consts = append(ce.Consts, &model.NamedType{Package: identPkg, Type: v.Name})
+			return nil
+		case *ast.SelectorExpr:
+			pkgIdent, ok := v.X.(*ast.Ident)
+			if !ok {
+				break
+			}
+			constPkg, ok := p.imports[pkgIdent.Name]
+			if !ok {
+				return p.errorf(v.Pos(), "unknown package %q", pkgIdent.Name)
+			}
+			b.WriteString("%s")
+			ce.Consts = append(ce.Consts, &model.NamedType{Package: constPkg, Type: v.Sel.Name})
+			return nil
+		case *ast.ParenExpr:
+			b.WriteString("(")
+			if err := walk(v.X); err != nil {
+				return err
+			}
+			b.WriteString(")")
+			return nil
+		case *ast.UnaryExpr:
+			b.WriteString(v.Op.String())
+			return walk(v.X)
+		case *ast.BinaryExpr:
+			if err := walk(v.X); err != nil {
+				return err
+			}
+			b.WriteString(" " + strings.ReplaceAll(v.Op.String(), "%", "%%") + " ")
+			return walk(v.Y)
+		}
+		return p.errorf(e.Pos(), "don't know how to parse constant expression %T", e)
+	}
+
+	if err := walk(expr); err != nil {
+		return nil, err
+	}
+	ce.Format = b.String()
+	return ce, nil
+}
+
+// constValue evaluates the integer constant name used at pos and declared in the package pkg.
+// seen holds the constants being evaluated, to detect cycles.
+func (p *fileParser) constValue(pos token.Pos, pkg, name string, seen map[string]bool) (constant.Value, error) {
+	key := pkg + "." + name
+	if seen[key] {
+		return nil, p.errorf(pos, "constant %s refers to itself", name)
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	files, err := p.parseImportedPackage(pos, pkg)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			// specs without values repeat the previous ones
+			var values []ast.Expr
+			for iota, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) > 0 {
+					values = vs.Values
+				}
+				for i, n := range vs.Names {
+					if n.Name != name {
+						continue
+					}
+					if i >= len(values) {
+						return nil, p.errorf(n.Pos(), "missing value of constant %s", name)
+					}
+					x, err := p.evalConst(pkg, file, values[i], int64(iota), seen)
+					if err != nil {
+						return nil, err
+					}
+					if x = constant.ToInt(x); x.Kind() != constant.Int {
+						return nil, p.errorf(pos, "constant %s is not an integer", name)
+					}
+					return x, nil
+				}
+			}
+		}
+	}
+	return nil, p.errorf(pos, "not found constant %s in package %s", name, pkg)
+}
+
+// evalConst evaluates the constant expression expr in file of the package pkg.
+func (p *fileParser) evalConst(pkg string, file *ast.File, expr ast.Expr, iota int64, seen map[string]bool) (constant.Value, error) {
+	switch v := expr.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(v.Value, v.Kind, 0), nil
+	case *ast.Ident:
+		switch v.Name {
+		case "iota":
+			return constant.MakeInt64(iota), nil
+		case "true", "false":
+			return constant.MakeBool(v.Name == "true"), nil
+		}
+		constPkg, err := p.dotImportedPackage(v.Pos(), dotImportsOfFile(file), v.Name, pkg)
+		if err != nil {
+			return nil, err
+		}
+		return p.constValue(v.Pos(), constPkg, v.Name, seen)
+	case *ast.SelectorExpr:
+		pkgIdent, ok := v.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		// import errors are already reported by interfacesOfFiles
+		imports, _ := p.importsOfFile(file)
+		constPkg, ok := imports[pkgIdent.Name]
+		if !ok {
+			return nil, p.errorf(v.Pos(), "unknown package %q", pkgIdent.Name)
+		}
+		return p.constValue(v.Pos(), constPkg, v.Sel.Name, seen)
+	case *ast.ParenExpr:
+		return p.evalConst(pkg, file, v.X, iota, seen)
+	case *ast.UnaryExpr:
+		x, err := p.evalConst(pkg, file, v.X, iota, seen)
+		if err != nil {
+			return nil, err
+		}
+		return constant.UnaryOp(v.Op, x, 0), nil
+	case *ast.BinaryExpr:
+		x, err := p.evalConst(pkg, file, v.X, iota, seen)
+		if err != nil {
+			return nil, err
+		}
+		y, err := p.evalConst(pkg, file, v.Y, iota, seen)
+		if err != nil {
+			return nil, err
+		}
+		switch v.Op {
+		case token.SHL, token.SHR:
+			s, ok := constant.Uint64Val(constant.ToInt(y))
+			if !ok {
+				return nil, p.errorf(v.Y.Pos(), "bad shift count %s", y)
+			}
+			return constant.Shift(x, v.Op, uint(s)), nil
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return constant.MakeBool(constant.Compare(x, v.Op, y)), nil
+		case token.QUO:
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				// integer division
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y), nil
+			}
+		}
+		return constant.BinaryOp(x, v.Op, y), nil
+	}
+	return nil, p.errorf(expr.Pos(), "don't know how to evaluate constant expression %T", expr)
+}
+
+// parseStruct parses the unnamed struct type st with fields.
+func (p *fileParser) parseStruct(pkg string, st *ast.StructType) (model.Type, error) {
+	t := &model.StructType{}
+	for _, f := range st.Fields.List {
+		ft, err := p.parseType(pkg, f.Type)
+		if err != nil {
+			return nil, err
+		}
+		var tag string
+		if f.Tag != nil {
+			tag, err = strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, p.errorf(f.Tag.Pos(), "bad struct tag: %v", err)
+			}
+		}
+
+		if len(f.Names) == 0 {
+			t.Fields = append(t.Fields, &model.Field{Type: ft, Tag: tag, Embedded: true})
+			continue
+		}
+		for _, name := range f.Names {
+			t.Fields = append(t.Fields, &model.Field{Name: name.Name, Type: ft, Tag: tag})
+		}
+	}
+	return t, nil
+}
+
+// parseInterfaceLiteral parses the unnamed interface type it with methods
+// or embedded types. Embedded types are kept as they are, not flattened.
+func (p *fileParser) parseInterfaceLiteral(pkg string, it *ast.InterfaceType) (model.Type, error) {
+	t := &model.InterfaceLiteralType{}
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			et, err := p.parseType(pkg, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			t.Embedded = append(t.Embedded, et)
+			continue
+		}
+
+		if nn := len(field.Names); nn != 1 {
+			return nil, p.errorf(field.Pos(), "expected one name for interface method, got %d", nn)
+		}
+		args, results, err := p.parseFunc(pkg, ft)
+		if err != nil {
+			return nil, err
+		}
+		t.Methods = append(t.Methods, &model.Method{Name: field.Names[0].Name, Args: args, Results: results})
+	}
+	return t, nil
+}
+
+func (p *fileParser) parseInstantiatedType(pkg string, x ast.Expr, indices []ast.Expr) (model.Type, error) {
+	t, err := p.parseType(pkg, x)
+	if err != nil {
+		return nil, err
+	}
+	it := &model.InstantiatedType{Type: t}
+	for _, index := range indices {
+		arg, err := p.parseType(pkg, index)
+		if err != nil {
+			return nil, err
+		}
+		it.TypeArgs = append(it.TypeArgs, arg)
+	}
+	return it, nil
+}
+
+// unionTerms returns the terms of t as an element of a union.
+func unionTerms(t model.Type) []*model.Term {
+	if u, ok := t.(*model.UnionType); ok {
+		return u.Terms
+	}
+	return []*model.Term{{Type: t}}
+}
+
+// errorf returns the error at pos, which is reported as "file:line:col: message".
+func (p *fileParser) errorf(pos token.Pos, format string, args ...interface{}) error {
+	return &scanner.Error{Pos: p.fileSet.Position(pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+// wrapf returns err prefixed with the context, keeping positions of err at the beginning.
+func wrapf(err error, format string, args ...interface{}) error {
+	context := fmt.Sprintf(format, args...)
+	switch v := err.(type) {
+	case *scanner.Error:
+		return &scanner.Error{Pos: v.Pos, Msg: context + ": " + v.Msg}
+	case scanner.ErrorList:
+		l := make(scanner.ErrorList, len(v))
+		for i, e := range v {
+			l[i] = &scanner.Error{Pos: e.Pos, Msg: context + ": " + e.Msg}
+		}
+		return l
+	}
+	return fmt.Errorf("%s: %v", context, err)
+}
+
+// fail records err if the parser collects all errors, otherwise returns it.
+func (p *fileParser) fail(err error) error {
+	if !p.opts.allErrors {
+		return err
+	}
+	p.errs.add(err)
+	return nil
+}
+
+// errorList is a list of errors reported one per line.
+type errorList []error
+
+// add appends err to the list, flattening lists of errors.
+func (l *errorList) add(err error) {
+	switch v := err.(type) {
+	case errorList:
+		*l = append(*l, v...)
+	case scanner.ErrorList:
+		for _, e := range v {
+			*l = append(*l, e)
+		}
+	default:
+		*l = append(*l, err)
+	}
+}
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// importsOfFile returns a map of package name to import path
+// of the imports in file.
+func (p *fileParser) importsOfFile(file *ast.File) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, is := range file.Imports {
+		var pkgName string
+		importPath := is.Path.Value[1 : len(is.Path.Value)-1] // remove quotes
+
+		if is.Name != nil {
+			// Named imports are always certain.
+			if is.Name.Name == "_" || is.Name.Name == "." {
+				continue
+			}
+			pkgName = is.Name.Name
+		} else {
+			pkg, err := build.Import(importPath, "", 0)
+			if err != nil {
+				// Fallback to import path suffix. Note that this is uncertain.
+				_, last := path.Split(importPath)
+				// If the last path component has dots, the first dot-delimited
+				// field is used as the name.
+				pkgName = strings.SplitN(last, ".", 2)[0]
+			} else {
+				pkgName = pkg.Name
+			}
+		}
+
+		if _, ok := m[pkgName]; ok {
+			return m, p.errorf(is.Pos(), "imported package collision: %q imported twice", pkgName)
+		}
+		m[pkgName] = importPath
+	}
+	return m, nil
+}
+
+// dotImportsOfFile returns the import paths of the packages
+// imported with "." in file.
+func dotImportsOfFile(file *ast.File) []string {
+	var paths []string
+	for _, is := range file.Imports {
+		if is.Name != nil && is.Name.Name == "." {
+			paths = append(paths, is.Path.Value[1:len(is.Path.Value)-1]) // remove quotes
+		}
+	}
+	return paths
+}
+
+// exportedNamesOfFiles returns the set of exported type and constant names declared in files.
+func exportedNamesOfFiles(files []*ast.File) map[string]bool {
+	m := make(map[string]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE && gd.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						m[s.Name.Name] = true
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						if n.IsExported() {
+							m[n.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// interfacesOfFiles returns a map of interface name to interface
+// declared in files.
+func (p *fileParser) interfacesOfFiles(files []*ast.File) (map[string]namedInterface, error) {
+	m := make(map[string]namedInterface)
+	for _, file := range files {
+		imports, err := p.importsOfFile(file)
+		if err != nil {
+			if err := p.fail(err); err != nil {
+				return nil, err
+			}
+		}
+		dotImports := dotImportsOfFile(file)
+		for _, ni := range interfacesOfFile(file) {
+			ni.imports = imports
+			ni.dotImports = dotImports
+			m[ni.name.Name] = ni
+		}
+	}
+	return m, nil
+}
+
+// isConstraintInterface reports whether it has type set elements
+// such as "~int | string", which make it usable only as a constraint.
+func isConstraintInterface(it *ast.InterfaceType) bool {
+	for _, field := range it.Methods.List {
+		switch field.Type.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			return true
+		}
+	}
+	return false
+}
+
+func interfacesOfFile(file *ast.File) []namedInterface {
+	var nis []namedInterface
+
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+
+			it, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				continue
+			}
+
+			nis = append(nis, namedInterface{name: ts.Name, it: it, typeParams: ts.TypeParams})
+		}
+	}
+
+	return nis
+}
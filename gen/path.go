@@ -0,0 +1,68 @@
+package gen
+
+import (
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DirPackagePath returns the import path of the package in the directory dir.
+// It is resolved by the nearest go.mod, falling back to GOPATH.
+func DirPackagePath(dir string) string {
+	dst, _ := filepath.Abs(dir)
+
+	if modDir, modPath := findModule(dst); modPath != "" {
+		rel, err := filepath.Rel(modDir, dst)
+		if err == nil {
+			return path.Join(modPath, filepath.ToSlash(rel))
+		}
+	}
+
+	for _, prefix := range build.Default.SrcDirs() {
+		if strings.HasPrefix(dst, prefix+string(filepath.Separator)) {
+			if rel, err := filepath.Rel(prefix, dst); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+	}
+
+	return ""
+}
+
+// findModule walks up from the absolute directory dir to find the nearest go.mod,
+// and returns its directory and module path.
+func findModule(dir string) (string, string) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			return dir, modulePath(data)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// modulePath returns the module path declared in the go.mod content.
+func modulePath(mod []byte) string {
+	for _, line := range strings.Split(string(mod), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if p, err := strconv.Unquote(fields[1]); err == nil {
+			return p
+		}
+		return fields[1]
+	}
+	return ""
+}
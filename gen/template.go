@@ -0,0 +1,238 @@
+package gen
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/y0za/interfake/model"
+)
+
+// DefaultTemplate is the text of the built-in template generating FakeX in ModeFake.
+// It is a starting point of custom templates.
+//
+//go:embed fake.tmpl
+var DefaultTemplate string
+
+var defaultTemplate = template.Must(ParseTemplate("fake.tmpl", DefaultTemplate))
+
+//go:embed spy.tmpl
+var spyTemplateText string
+
+var spyTemplate = template.Must(ParseTemplate("spy.tmpl", spyTemplateText))
+
+// callsTemplate defines the templates recording calls shared by the built-in templates.
+//
+//go:embed calls.tmpl
+var callsTemplate string
+
+// TemplateData is the data of the template generating the implementation of an interface.
+type TemplateData struct {
+	Interface *model.Interface
+	// TypeName is the name of the generated type.
+	TypeName string
+	Mode     Mode
+	Unset    UnsetMode
+	// Assert reports whether to assert the generated type implements the interface.
+	Assert bool
+	// Constructor reports whether to generate the constructor.
+	Constructor bool
+
+	g *Generator
+}
+
+// InterfaceType returns the interface type with its type arguments,
+// which can be referred only if Assert is true.
+func (d *TemplateData) InterfaceType() string {
+	it := &model.NamedType{Package: d.Interface.Package, Type: d.Interface.Name}
+	d.g.use(it)
+	return it.String(d.g.pt) + d.Interface.TypeArgsString()
+}
+
+// WithMethod returns the data of the method m of the interface.
+func (d *TemplateData) WithMethod(m *model.Method) *MethodData {
+	return &MethodData{TemplateData: d, Method: m}
+}
+
+// MethodData is the data of the templates "callType" and "callAccessors",
+// which generate the code recording calls of a method.
+type MethodData struct {
+	*TemplateData
+	Method *model.Method
+}
+
+// ParseTemplate parses text as a template generating the implementation of an interface.
+// The template is executed with a *TemplateData for each interface, and can use the functions:
+//
+//	import "path"            imports the package path and returns its name
+//	type T                   the model.Type T
+//	typeParams intf          the type parameter list of intf such as "[K comparable, V any]"
+//	funcType m               the type of the method m such as "func(int) error"
+//	zero T                   the zero value of the model.Type T
+//	paramType p              the type of the parameter p, prefixed with "..." if variadic
+//	storedType p             the type of the parameter p as a value, a slice if variadic
+//	scope intf               a new scope of identifiers of a method
+//	name scope "base"        an identifier based on base unused in scope
+//	args scope params        params renamed to identifiers unused in scope
+//	formalArgs params        the parameter list such as "a int, b ...string"
+//	actualArgs params        the argument list such as "a, b..."
+//	results params           the result list such as " (int, error)"
+//	funcField m              the name of the func field handling the method m
+//	callType typeName m      the name of the type recording a call of the method m
+//	callsField m             the name of the field holding recorded calls of the method m
+//	resultsType typeName m   the name of the type holding canned results of the method m
+//	returnsField m           the name of the field holding canned results of the method m
+//
+// The template can also execute the templates shared by the built-in templates
+// with a *MethodData such as {{template "callType" ($.WithMethod $m)}}:
+//
+//	callType                 the type recording a call of the method, including its results in ModeSpy
+//	callAccessors            the methods inspecting the recorded calls of the method
+func ParseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs((&Generator{}).templateFuncs()).Parse(callsTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(text)
+}
+
+// template returns the template generating implementations,
+// or nil if the built-in implementation of g.Mode is generated by code.
+func (g *Generator) template() (*template.Template, error) {
+	tmpl := g.Template
+	if tmpl == nil {
+		switch g.Mode {
+		case ModeFake:
+			tmpl = defaultTemplate
+		case ModeSpy:
+			tmpl = spyTemplate
+		default:
+			return nil, nil
+		}
+	}
+
+	// functions refer to the package table of g
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Funcs(g.templateFuncs()), nil
+}
+
+// templateImports executes tmpl for intfs without output, and returns the packages
+// imported by the template and the packages of pps referred by the printed types.
+func (g *Generator) templateImports(tmpl *template.Template, intfs []*model.Interface, outputPackagePath string, pps model.PackagePathSet) (model.PackagePathSet, model.PackagePathSet, error) {
+	// provisional names of packages
+	g.pt, _ = newPackageTable(nil, pps)
+	g.pt[outputPackagePath] = ""
+
+	g.imports = make(model.PackagePathSet)
+	g.used = make(model.PackagePathSet)
+	defer func() { g.imports, g.used = nil, nil }()
+
+	for _, intf := range intfs {
+		err := tmpl.Execute(io.Discard, g.templateData(intf, outputPackagePath))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed executing template: %v", err)
+		}
+	}
+	return g.imports, g.used, nil
+}
+
+func (g *Generator) templateData(intf *model.Interface, outputPackagePath string) *TemplateData {
+	return &TemplateData{
+		Interface:   intf,
+		TypeName:    g.typeName(intf),
+		Mode:        g.Mode,
+		Unset:       g.Unset,
+		Assert:      g.assertable(intf, outputPackagePath),
+		Constructor: g.Constructor,
+		g:           g,
+	}
+}
+
+// use records the packages of the types ts printed by the template
+// while finding its imports.
+func (g *Generator) use(ts ...model.Type) {
+	if g.used == nil {
+		return
+	}
+	for _, t := range ts {
+		for path := range model.TypePackagePaths(t) {
+			g.used[path] = struct{}{}
+		}
+	}
+}
+
+// useParams records the packages of the types of params printed by the template.
+func (g *Generator) useParams(params []*model.Parameter) {
+	for _, p := range params {
+		g.use(p.Type)
+	}
+}
+
+func (g *Generator) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"import": func(path string) (string, error) {
+			if g.imports != nil {
+				g.imports[path] = struct{}{}
+				name, _ := packageName(path)
+				return name, nil
+			}
+			name, ok := g.pt[path]
+			if !ok {
+				return "", fmt.Errorf("package %q is not imported", path)
+			}
+			return name, nil
+		},
+		"type": func(t model.Type) string {
+			g.use(t)
+			return t.String(g.pt)
+		},
+		"typeParams": func(intf *model.Interface) string {
+			for _, tp := range intf.TypeParams {
+				g.use(tp.Constraint)
+			}
+			return intf.TypeParamsString(g.pt)
+		},
+		"funcType": func(m *model.Method) string {
+			g.useParams(m.Args)
+			g.useParams(m.Results)
+			return (&model.FuncType{Args: m.Args, Results: m.Results}).String(g.pt)
+		},
+		"zero": func(t model.Type) string {
+			g.use(t)
+			return model.ZeroValue(t, g.pt)
+		},
+		"paramType": func(p *model.Parameter) string {
+			g.use(p.Type)
+			return p.TypeString(g.pt)
+		},
+		"storedType": func(p *model.Parameter) string {
+			g.use(p.Type)
+			return storedTypeString(p, g.pt)
+		},
+		"scope": g.newMethodScope,
+		"name": func(s methodScope, base string) string {
+			return s.name(base)
+		},
+		"args": func(s methodScope, params []*model.Parameter) []*model.Parameter {
+			return s.args(params)
+		},
+		"formalArgs": func(params []*model.Parameter) string {
+			g.useParams(params)
+			return formalArgsString(params, g.pt)
+		},
+		"actualArgs": actualArgsString,
+		"results": func(params []*model.Parameter) string {
+			g.useParams(params)
+			return resultsString(params, g.pt)
+		},
+		"funcField":    g.funcFieldName,
+		"callType":     callTypeName,
+		"callsField":   callsFieldName,
+		"resultsType":  resultsTypeName,
+		"returnsField": returnsFieldName,
+	}
+}
@@ -2,97 +2,219 @@ package main
 
 import (
 	"flag"
-	"go/build"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/y0za/interfake/gen"
 	"github.com/y0za/interfake/model"
 )
 
 var (
-	targetOption  = flag.String("target", "", "target interface")
-	packageOption = flag.String("package", "", "package of the generated code")
-	outputOption  = flag.String("output", "", "output file name")
+	targetOption        = flag.String("target", "", "comma-separated list of target interfaces, optionally qualified by import path such as io.Reader")
+	allOption           = flag.Bool("all", false, "target all exported interfaces")
+	sourcePackageOption = flag.String("source-package", "", "import path of the package declaring target interfaces")
+	sourceOption        = flag.String("source", "", "Go source file declaring target interfaces, which may be a _test.go file")
+	packageOption       = flag.String("package", "", "package of the generated code")
+	outputOption        = flag.String("output", "", "output file name")
+	outputDirOption     = flag.String("output-dir", "", "output directory to write one file per interface")
+	typecheckOption     = flag.Bool("typecheck", false, "load interfaces with type checking by go/types")
+	modeOption          = flag.String("mode", "fake", "kind of the generated implementation: fake, mock or spy")
+	unsetOption         = flag.String("unset", "nil", "behavior of fake methods whose func is not set: nil, zero or strict")
+	assertOption        = flag.Bool("assert", true, "assert the generated types implement the interfaces at compile time")
+	constructorOption   = flag.Bool("constructor", false, "generate NewFakeX constructors")
+	checkOption         = flag.Bool("check", false, "check the output files are up to date instead of writing them, and print their diff")
+	allErrorsOption     = flag.Bool("all-errors", false, "report all errors found in the source files instead of only the first one")
+	templateOption      = flag.String("template", "", "text/template file generating the implementation of each interface instead of the built-in one")
+	typeNameOption      = flag.String("type-name", "", "name of the generated types such as Stub<Interface>, Fake<Interface> by default")
+	typeNamesOption     = flag.String("type-names", "", "comma-separated overrides of the generated type names by interface such as Reader=StubReader")
+	fieldNameOption     = flag.String("field-name", "", "name of the func fields handling methods such as <Method>Func, Fake<Method> by default")
 )
 
 func main() {
-	var err error
 	flag.Parse()
 
-	if *targetOption == "" {
-		log.Fatal("target option must be set")
+	if *targetOption == "" && !*allOption {
+		log.Fatal("target or all option must be set")
 	}
-
-	files, err := parsePackageDir(".")
-	intf, pkg := seekInterface(files, *targetOption)
-	if intf == nil {
-		log.Fatalf("not found interface %s", *targetOption)
+	if *targetOption != "" && *allOption {
+		log.Fatal("target and all options are mutually exclusive")
+	}
+	if *outputOption != "" && *outputDirOption != "" {
+		log.Fatal("output and output-dir options are mutually exclusive")
+	}
+	if *checkOption && *outputOption == "" && *outputDirOption == "" {
+		log.Fatal("check option requires output or output-dir option")
+	}
+	mode, err := gen.ParseMode(*modeOption)
+	if err != nil {
+		log.Fatal(err)
+	}
+	unset, err := gen.ParseUnsetMode(*unsetOption)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	outPackageName := *packageOption
-	if outPackageName == "" {
-		outPackageName = "fake_" + pkg
+	sourcePkg := *sourcePackageOption
+	var targets []string
+	if *targetOption != "" {
+		for _, t := range strings.Split(*targetOption, ",") {
+			t = strings.TrimSpace(t)
+			if i := strings.LastIndex(t, "."); i > strings.LastIndex(t, "/") {
+				if sourcePkg != "" && sourcePkg != t[:i] {
+					log.Fatalf("target %s is not in the source package %s", t, sourcePkg)
+				}
+				sourcePkg, t = t[:i], t[i+1:]
+			}
+			targets = append(targets, t)
+		}
 	}
 
-	outPackagePath := packagePath(*outputOption)
+	if *sourceOption != "" && sourcePkg != "" {
+		log.Fatal("source option can't be used with source package")
+	}
 
-	output := os.Stdout
-	if *outputOption != "" {
-		abs, err := filepath.Abs(*outputOption)
-		if err != nil {
-			log.Fatalf("failed identifying output parent directory: %v", err)
+	opts := gen.Options{
+		SourcePackage: sourcePkg,
+		Source:        *sourceOption,
+		Targets:       targets,
+		Typecheck:     *typecheckOption,
+		AllErrors:     *allErrorsOption,
+		Warn:          func(err error) { log.Printf("warning: %v", err) },
+		Package:       *packageOption,
+		Mode:          mode,
+		Unset:         unset,
+		Assert:        *assertOption,
+		Constructor:   *constructorOption,
+		TypeName:      *typeNameOption,
+		FieldName:     *fieldNameOption,
+	}
+	if *typeNamesOption != "" {
+		opts.TypeNames = make(map[string]string)
+		for _, kv := range strings.Split(*typeNamesOption, ",") {
+			intf, name, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				log.Fatalf("type name %q must be in the form Interface=Name", kv)
+			}
+			opts.TypeNames[intf] = name
 		}
-		dir := filepath.Dir(abs)
-		err = os.MkdirAll(dir, 0777)
+	}
+	if *templateOption != "" {
+		text, err := os.ReadFile(*templateOption)
 		if err != nil {
-			log.Fatalf("failed making output parent directory: %v", err)
+			log.Fatalf("failed reading template: %v", err)
 		}
-		output, err = os.Create(abs)
+		opts.Template, err = gen.ParseTemplate(filepath.Base(*templateOption), string(text))
 		if err != nil {
-			log.Fatalf("failed opening output file: %v", err)
+			log.Fatalf("failed parsing template: %v", err)
 		}
-		defer output.Close()
 	}
 
-	g := NewGenerator()
-	err = g.Generate(intf, outPackageName, outPackagePath)
+	intfs, pkg, err := gen.Load(opts)
 	if err != nil {
-		log.Fatalf("failed generating code: %v", err)
+		log.Fatal(err)
 	}
-	err = g.Format()
-	if err != nil {
-		log.Fatalf("failed formatting code: %v", err)
+	if opts.Package == "" {
+		opts.Package = "fake_" + pkg
 	}
 
-	g.WriteTo(output)
-}
+	var outputs []output
+	if *outputDirOption != "" {
+		outPackagePath := outputPackagePath(gen.DirPackagePath(*outputDirOption), opts.Package)
+		for _, intf := range intfs {
+			outputs = append(outputs, output{
+				name:    filepath.Join(*outputDirOption, strings.ToLower(mode.String())+"_"+strings.ToLower(intf.Name)+".go"),
+				intfs:   []*model.Interface{intf},
+				pkgPath: outPackagePath,
+			})
+		}
+	} else {
+		outputs = append(outputs, output{
+			name:    *outputOption,
+			intfs:   intfs,
+			pkgPath: outputPackagePath(gen.PackagePath(*outputOption), opts.Package),
+		})
+	}
+
+	stale := false
+	for _, o := range outputs {
+		opts.PackagePath = o.pkgPath
+		code, err := gen.Generate(o.intfs, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-func seekInterface(files []*model.GoFile, interfaceName string) (*model.Interface, string) {
-	for _, f := range files {
-		for _, i := range f.Interfaces {
-			if i.Name == interfaceName {
-				return i, f.PackageName
+		if *checkOption {
+			diff, err := checkFake(o.name, code)
+			if err != nil {
+				log.Fatal(err)
 			}
+			if diff != "" {
+				fmt.Print(diff)
+				stale = true
+			}
+			continue
 		}
+
+		err = writeFake(o.name, code)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if stale {
+		os.Exit(1)
 	}
-	return nil, ""
 }
 
-func packagePath(outPath string) string {
-	if outPath == "" {
-		return ""
+// output is a generated file.
+type output struct {
+	name    string // empty for the standard output
+	intfs   []*model.Interface
+	pkgPath string
+}
+
+// outputPackagePath returns the import path of the generated package pkg
+// in the directory of the package path, which is the external test package
+// if pkg is a test package.
+func outputPackagePath(path, pkg string) string {
+	if path != "" && strings.HasSuffix(pkg, "_test") && !strings.HasSuffix(path, "_test") {
+		return path + "_test"
 	}
+	return path
+}
 
-	dst, _ := filepath.Abs(filepath.Dir(outPath))
-	for _, prefix := range build.Default.SrcDirs() {
-		if strings.HasPrefix(dst, prefix) {
-			if rel, err := filepath.Rel(prefix, dst); err == nil {
-				return rel
-			}
-		}
+// checkFake compares the generated code with the file name.
+// It returns the unified diff if the file is not up to date.
+func checkFake(name string, code []byte) (string, error) {
+	current, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed reading output file: %v", err)
 	}
 
-	return ""
+	return unifiedDiff(name, name+" (generated)", current, code), nil
+}
+
+// writeFake writes the generated code into the file name.
+// It writes to the standard output if name is empty.
+func writeFake(name string, code []byte) error {
+	if name == "" {
+		_, err := os.Stdout.Write(code)
+		return err
+	}
+
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf("failed identifying output parent directory: %v", err)
+	}
+	err = os.MkdirAll(filepath.Dir(abs), 0777)
+	if err != nil {
+		return fmt.Errorf("failed making output parent directory: %v", err)
+	}
+	err = os.WriteFile(abs, code, 0666)
+	if err != nil {
+		return fmt.Errorf("failed writing output file: %v", err)
+	}
+	return nil
 }
@@ -7,6 +7,7 @@ package model
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -34,25 +35,70 @@ func (gf *GoFile) Print(w io.Writer) {
 
 // Interface is a Go interface.
 type Interface struct {
-	Name    string
-	Methods []*Method
+	Name        string
+	Package     string       // import path of the package declaring the interface
+	PackageName string       // name of the package declaring the interface
+	TypeParams  []*TypeParam // nil if not generic
+	Methods     []*Method
 }
 
 func (intf *Interface) Print(w io.Writer) {
-	fmt.Fprintf(w, "interface %s\n", intf.Name)
+	fmt.Fprintf(w, "interface %s%s\n", intf.Name, intf.TypeParamsString(nil))
 	for _, m := range intf.Methods {
 		m.Print(w)
 	}
 }
 
+// TypePackagePaths returns the package paths referred by the type t.
+func TypePackagePaths(t Type) PackagePathSet {
+	pps := make(PackagePathSet)
+	t.addPackagePaths(pps)
+	return pps
+}
+
 func (intf *Interface) PackagePaths() PackagePathSet {
 	pps := make(PackagePathSet)
+	for _, tp := range intf.TypeParams {
+		tp.Constraint.addPackagePaths(pps)
+	}
 	for _, method := range intf.Methods {
 		method.addPackagePaths(pps)
 	}
 	return pps
 }
 
+// TypeParamsString returns the type parameter list such as "[K comparable, V any]".
+// It returns an empty string if intf is not generic.
+func (intf *Interface) TypeParamsString(pt PackageTable) string {
+	if len(intf.TypeParams) == 0 {
+		return ""
+	}
+	tps := make([]string, len(intf.TypeParams))
+	for i, tp := range intf.TypeParams {
+		tps[i] = tp.Name + " " + tp.Constraint.String(pt)
+	}
+	return "[" + strings.Join(tps, ", ") + "]"
+}
+
+// TypeArgsString returns the type parameter names as type arguments such as "[K, V]".
+// It returns an empty string if intf is not generic.
+func (intf *Interface) TypeArgsString() string {
+	if len(intf.TypeParams) == 0 {
+		return ""
+	}
+	names := make([]string, len(intf.TypeParams))
+	for i, tp := range intf.TypeParams {
+		names[i] = tp.Name
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// TypeParam is a type parameter of a generic interface.
+type TypeParam struct {
+	Name       string
+	Constraint Type
+}
+
 // Method is a single method of an interface.
 type Method struct {
 	Name    string
@@ -76,6 +122,24 @@ func (m *Method) Print(w io.Writer) {
 	}
 }
 
+// SameSignature reports whether m and other have identical signatures.
+// Parameter names are ignored.
+func (m *Method) SameSignature(other *Method) bool {
+	ft := &FuncType{Args: m.Args, Results: m.Results}
+	oft := &FuncType{Args: other.Args, Results: other.Results}
+
+	// qualify named types by their full package path
+	pps := make(PackagePathSet)
+	ft.addPackagePaths(pps)
+	oft.addPackagePaths(pps)
+	pt := make(PackageTable)
+	for path := range pps {
+		pt[path] = path
+	}
+
+	return ft.String(pt) == oft.String(pt)
+}
+
 func (m *Method) addPackagePaths(pps PackagePathSet) {
 	for _, p := range m.Args {
 		p.Type.addPackagePaths(pps)
@@ -87,8 +151,17 @@ func (m *Method) addPackagePaths(pps PackagePathSet) {
 
 // Parameter is an argument or return parameter of a method.
 type Parameter struct {
-	Name string // may be empty
-	Type Type
+	Name     string // may be empty
+	Type     Type   // element type if Variadic
+	Variadic bool   // only the last argument may be variadic
+}
+
+// TypeString returns the type of the parameter, prefixed with "..." if variadic.
+func (p *Parameter) TypeString(pt PackageTable) string {
+	if p.Variadic {
+		return "..." + p.Type.String(pt)
+	}
+	return p.Type.String(pt)
 }
 
 func (p *Parameter) Print(w io.Writer) {
@@ -96,7 +169,7 @@ func (p *Parameter) Print(w io.Writer) {
 	if n == "" {
 		n = `""`
 	}
-	fmt.Fprintf(w, "    - %v: %v\n", n, p.Type.String(nil))
+	fmt.Fprintf(w, "    - %v: %v\n", n, p.TypeString(nil))
 }
 
 type Type interface {
@@ -104,19 +177,76 @@ type Type interface {
 	addPackagePaths(pps PackagePathSet)
 }
 
+// ZeroValue returns an expression of the zero value of t.
+func ZeroValue(t Type, pt PackageTable) string {
+	switch v := t.(type) {
+	case PredeclaredType:
+		switch v {
+		case "bool":
+			return "false"
+		case "string":
+			return `""`
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return "0"
+		case "error", "any", "interface{}":
+			return "nil"
+		case "struct{}":
+			return "struct{}{}"
+		}
+	case *ArrayType, *StructType:
+		return v.String(pt) + "{}"
+	case *ChanType, *FuncType, *InterfaceLiteralType, *MapType, *PointerType, *SliceType:
+		return "nil"
+	}
+	// The underlying type of named types and type parameters is unknown.
+	return "*new(" + t.String(pt) + ")"
+}
+
+// ArrayType is an array type.
+// Its length is LenExpr if it is a constant expression such as "sha256.Size", otherwise Len.
 type ArrayType struct {
-	Len  int
-	Type Type
+	Len     int
+	LenExpr *ConstExpr // may be nil
+	Type    Type
 }
 
 func (at *ArrayType) String(pt PackageTable) string {
+	if at.LenExpr != nil {
+		return "[" + at.LenExpr.String(pt) + "]" + at.Type.String(pt)
+	}
 	return fmt.Sprintf("[%d]", at.Len) + at.Type.String(pt)
 }
 
 func (at *ArrayType) addPackagePaths(pps PackagePathSet) {
+	if at.LenExpr != nil {
+		at.LenExpr.addPackagePaths(pps)
+	}
 	at.Type.addPackagePaths(pps)
 }
 
+// ConstExpr is a constant expression in the source such as "2 * sha256.Size".
+// Constants are qualified like named types and substituted for the %s verbs in Format.
+type ConstExpr struct {
+	Format string
+	Consts []*NamedType
+}
+
+func (ce *ConstExpr) String(pt PackageTable) string {
+	args := make([]interface{}, len(ce.Consts))
+	for i, c := range ce.Consts {
+		args[i] = c.String(pt)
+	}
+	return fmt.Sprintf(ce.Format, args...)
+}
+
+func (ce *ConstExpr) addPackagePaths(pps PackagePathSet) {
+	for _, c := range ce.Consts {
+		c.addPackagePaths(pps)
+	}
+}
+
 type SliceType struct {
 	Type Type
 }
@@ -167,7 +297,7 @@ type FuncType struct {
 func (ft *FuncType) String(pt PackageTable) string {
 	args := make([]string, len(ft.Args))
 	for i, p := range ft.Args {
-		args[i] = p.Type.String(pt)
+		args[i] = p.TypeString(pt)
 	}
 
 	results := make([]string, len(ft.Results))
@@ -209,16 +339,19 @@ func (mt *MapType) addPackagePaths(pps PackagePathSet) {
 }
 
 // NamedType is an exported type in a package.
+// It is not qualified if the package has no name in the PackageTable,
+// such as the package of the generated code.
 type NamedType struct {
 	Package string // may be empty
 	Type    string
 }
 
 func (nt *NamedType) String(pt PackageTable) string {
-	if nt.Package == "" {
+	name := pt[nt.Package]
+	if nt.Package == "" || name == "" {
 		return nt.Type
 	}
-	return pt[nt.Package] + "." + nt.Type
+	return name + "." + nt.Type
 }
 
 func (nt *NamedType) addPackagePaths(pps PackagePathSet) {
@@ -249,3 +382,127 @@ func (pType PredeclaredType) String(pt PackageTable) string {
 
 func (_ PredeclaredType) addPackagePaths(pps PackagePathSet) {
 }
+
+// StructType is an unnamed struct type with fields.
+type StructType struct {
+	Fields []*Field
+}
+
+// Field is a field of a struct type.
+type Field struct {
+	Name     string // empty if Embedded
+	Type     Type
+	Tag      string // unquoted tag, may be empty
+	Embedded bool
+}
+
+func (st *StructType) String(pt PackageTable) string {
+	if len(st.Fields) == 0 {
+		return "struct{}"
+	}
+	fields := make([]string, len(st.Fields))
+	for i, f := range st.Fields {
+		fields[i] = f.Type.String(pt)
+		if !f.Embedded {
+			fields[i] = f.Name + " " + fields[i]
+		}
+		if f.Tag != "" {
+			fields[i] += " " + quoteTag(f.Tag)
+		}
+	}
+	return "struct{ " + strings.Join(fields, "; ") + " }"
+}
+
+func (st *StructType) addPackagePaths(pps PackagePathSet) {
+	for _, f := range st.Fields {
+		f.Type.addPackagePaths(pps)
+	}
+}
+
+// quoteTag returns tag as a raw string literal if possible.
+func quoteTag(tag string) string {
+	if !strconv.CanBackquote(tag) {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// InterfaceLiteralType is an unnamed interface type with methods
+// or embedded types, such as "interface{ Done() <-chan struct{} }".
+type InterfaceLiteralType struct {
+	Methods  []*Method
+	Embedded []Type
+}
+
+func (it *InterfaceLiteralType) String(pt PackageTable) string {
+	var elems []string
+	for _, t := range it.Embedded {
+		elems = append(elems, t.String(pt))
+	}
+	for _, m := range it.Methods {
+		ft := &FuncType{Args: m.Args, Results: m.Results}
+		elems = append(elems, m.Name+strings.TrimPrefix(ft.String(pt), "func"))
+	}
+	if len(elems) == 0 {
+		return "interface{}"
+	}
+	return "interface{ " + strings.Join(elems, "; ") + " }"
+}
+
+func (it *InterfaceLiteralType) addPackagePaths(pps PackagePathSet) {
+	for _, t := range it.Embedded {
+		t.addPackagePaths(pps)
+	}
+	for _, m := range it.Methods {
+		m.addPackagePaths(pps)
+	}
+}
+
+// InstantiatedType is a generic type instantiated with type arguments.
+type InstantiatedType struct {
+	Type     Type
+	TypeArgs []Type
+}
+
+func (it *InstantiatedType) String(pt PackageTable) string {
+	args := make([]string, len(it.TypeArgs))
+	for i, t := range it.TypeArgs {
+		args[i] = t.String(pt)
+	}
+	return it.Type.String(pt) + "[" + strings.Join(args, ", ") + "]"
+}
+
+func (it *InstantiatedType) addPackagePaths(pps PackagePathSet) {
+	it.Type.addPackagePaths(pps)
+	for _, t := range it.TypeArgs {
+		t.addPackagePaths(pps)
+	}
+}
+
+// UnionType is a union of type terms in a type constraint such as "~int | string".
+type UnionType struct {
+	Terms []*Term
+}
+
+// Term is a single term of a union.
+type Term struct {
+	Tilde bool
+	Type  Type
+}
+
+func (ut *UnionType) String(pt PackageTable) string {
+	terms := make([]string, len(ut.Terms))
+	for i, t := range ut.Terms {
+		terms[i] = t.Type.String(pt)
+		if t.Tilde {
+			terms[i] = "~" + terms[i]
+		}
+	}
+	return strings.Join(terms, " | ")
+}
+
+func (ut *UnionType) addPackagePaths(pps PackagePathSet) {
+	for _, t := range ut.Terms {
+		t.Type.addPackagePaths(pps)
+	}
+}
@@ -15,10 +15,15 @@ func TestNamedTypeString(t *testing.T) {
 			NamedType{"foo", "Bar"},
 			"Foo.Bar",
 		},
+		{
+			NamedType{"out", "Bar"},
+			"Bar",
+		},
 	}
 
 	pt := PackageTable{
 		"foo": "Foo",
+		"out": "",
 	}
 	for _, tt := range cases {
 		actual := tt.nt.String(pt)
@@ -111,3 +116,292 @@ func TestPredeclaredTypeAddPackagePaths(t *testing.T) {
 		}
 	}
 }
+
+func TestMethodSameSignature(t *testing.T) {
+	cases := []struct {
+		m        Method
+		other    Method
+		expected bool
+	}{
+		{
+			Method{Name: "Read", Args: []*Parameter{{Name: "p", Type: &SliceType{PredeclaredType("byte")}}}},
+			Method{Name: "Read", Args: []*Parameter{{Name: "b", Type: &SliceType{PredeclaredType("byte")}}}},
+			true,
+		},
+		{
+			Method{Name: "Close", Results: []*Parameter{{Type: PredeclaredType("error")}}},
+			Method{Name: "Close"},
+			false,
+		},
+		{
+			Method{Name: "Get", Results: []*Parameter{{Type: &NamedType{"foo", "Bar"}}}},
+			Method{Name: "Get", Results: []*Parameter{{Type: &NamedType{"baz", "Bar"}}}},
+			false,
+		},
+	}
+
+	for _, tt := range cases {
+		actual := tt.m.SameSignature(&tt.other)
+		if actual != tt.expected {
+			t.Errorf("expected %v actual %v for %s", tt.expected, actual, tt.m.Name)
+		}
+	}
+}
+
+func TestFuncTypeString(t *testing.T) {
+	cases := []struct {
+		ft       FuncType
+		expected string
+	}{
+		{
+			FuncType{},
+			"func()",
+		},
+		{
+			FuncType{
+				Args:    []*Parameter{{Type: PredeclaredType("string")}},
+				Results: []*Parameter{{Type: PredeclaredType("error")}},
+			},
+			"func(string) error",
+		},
+		{
+			FuncType{
+				Args: []*Parameter{
+					{Type: PredeclaredType("string")},
+					{Type: PredeclaredType("interface{}"), Variadic: true},
+				},
+			},
+			"func(string, ...interface{})",
+		},
+		{
+			FuncType{
+				Args: []*Parameter{{Type: &NamedType{"foo", "Option"}, Variadic: true}},
+				Results: []*Parameter{
+					{Type: &PointerType{&NamedType{"foo", "Bar"}}},
+					{Type: PredeclaredType("error")},
+				},
+			},
+			"func(...Foo.Option) (*Foo.Bar, error)",
+		},
+	}
+
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+	for _, tt := range cases {
+		actual := tt.ft.String(pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}
+
+func TestInstantiatedTypeString(t *testing.T) {
+	cases := []struct {
+		it       InstantiatedType
+		expected string
+	}{
+		{
+			InstantiatedType{&NamedType{"foo", "Cache"}, []Type{PredeclaredType("string"), PredeclaredType("int")}},
+			"Foo.Cache[string, int]",
+		},
+		{
+			InstantiatedType{&NamedType{"", "List"}, []Type{&PointerType{&NamedType{"foo", "Bar"}}}},
+			"List[*Foo.Bar]",
+		},
+	}
+
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+	for _, tt := range cases {
+		actual := tt.it.String(pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}
+
+func TestInterfaceTypeParamsString(t *testing.T) {
+	intf := Interface{
+		Name: "Repo",
+		TypeParams: []*TypeParam{
+			{"K", PredeclaredType("comparable")},
+			{"V", &UnionType{[]*Term{{true, PredeclaredType("int")}, {false, &NamedType{"foo", "Bar"}}}}},
+		},
+	}
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+
+	if actual, expected := intf.TypeParamsString(pt), "[K comparable, V ~int | Foo.Bar]"; actual != expected {
+		t.Errorf(`expected "%s" actual "%s"`, expected, actual)
+	}
+	if actual, expected := intf.TypeArgsString(), "[K, V]"; actual != expected {
+		t.Errorf(`expected "%s" actual "%s"`, expected, actual)
+	}
+	if _, ok := intf.PackagePaths()["foo"]; !ok {
+		t.Errorf("expected PackagePathSet contains foo")
+	}
+
+	intf.TypeParams = nil
+	if actual := intf.TypeParamsString(pt); actual != "" {
+		t.Errorf(`expected "" actual "%s"`, actual)
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	cases := []struct {
+		t        Type
+		expected string
+	}{
+		{PredeclaredType("bool"), "false"},
+		{PredeclaredType("string"), `""`},
+		{PredeclaredType("float64"), "0"},
+		{PredeclaredType("error"), "nil"},
+		{PredeclaredType("struct{}"), "struct{}{}"},
+		{&ArrayType{Len: 3, Type: PredeclaredType("int")}, "[3]int{}"},
+		{&ChanType{RecvDirection, PredeclaredType("int")}, "nil"},
+		{&MapType{PredeclaredType("string"), PredeclaredType("int")}, "nil"},
+		{&PointerType{&NamedType{"foo", "Bar"}}, "nil"},
+		{&SliceType{PredeclaredType("byte")}, "nil"},
+		{&FuncType{}, "nil"},
+		{&InterfaceLiteralType{Methods: []*Method{{Name: "Close"}}}, "nil"},
+		{&StructType{[]*Field{{Name: "A", Type: PredeclaredType("int")}}}, "struct{ A int }{}"},
+		{&NamedType{"foo", "Bar"}, "*new(Foo.Bar)"},
+		{&NamedType{"", "T"}, "*new(T)"},
+	}
+
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+	for _, tt := range cases {
+		actual := ZeroValue(tt.t, pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}
+
+func TestStructTypeString(t *testing.T) {
+	cases := []struct {
+		st       StructType
+		expected string
+	}{
+		{
+			StructType{},
+			"struct{}",
+		},
+		{
+			StructType{[]*Field{
+				{Name: "Hits", Type: PredeclaredType("int")},
+				{Name: "Misses", Type: PredeclaredType("int")},
+			}},
+			"struct{ Hits int; Misses int }",
+		},
+		{
+			StructType{[]*Field{
+				{Type: &NamedType{"foo", "Bar"}, Embedded: true},
+				{Name: "Name", Type: PredeclaredType("string"), Tag: `json:"name"`},
+			}},
+			"struct{ Foo.Bar; Name string `json:\"name\"` }",
+		},
+		{
+			StructType{[]*Field{
+				{Name: "A", Type: PredeclaredType("int"), Tag: "a`b"},
+			}},
+			"struct{ A int \"a`b\" }",
+		},
+	}
+
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+	for _, tt := range cases {
+		actual := tt.st.String(pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}
+
+func TestInterfaceLiteralTypeString(t *testing.T) {
+	cases := []struct {
+		it       InterfaceLiteralType
+		expected string
+	}{
+		{
+			InterfaceLiteralType{},
+			"interface{}",
+		},
+		{
+			InterfaceLiteralType{
+				Methods: []*Method{{
+					Name:    "Done",
+					Results: []*Parameter{{Type: &ChanType{RecvDirection, PredeclaredType("struct{}")}}},
+				}},
+			},
+			"interface{ Done() <-chan struct{} }",
+		},
+		{
+			InterfaceLiteralType{
+				Methods: []*Method{{
+					Name: "Close",
+					Results: []*Parameter{
+						{Name: "err", Type: PredeclaredType("error")},
+					},
+				}},
+				Embedded: []Type{&NamedType{"foo", "Reader"}},
+			},
+			"interface{ Foo.Reader; Close() error }",
+		},
+	}
+
+	pt := PackageTable{
+		"foo": "Foo",
+	}
+	for _, tt := range cases {
+		actual := tt.it.String(pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}
+
+func TestArrayTypeString(t *testing.T) {
+	cases := []struct {
+		at       ArrayType
+		expected string
+	}{
+		{
+			ArrayType{Len: 16, Type: PredeclaredType("byte")},
+			"[16]byte",
+		},
+		{
+			ArrayType{
+				LenExpr: &ConstExpr{"%s", []*NamedType{{"crypto/sha256", "Size"}}},
+				Type:    PredeclaredType("byte"),
+			},
+			"[sha256.Size]byte",
+		},
+		{
+			ArrayType{
+				LenExpr: &ConstExpr{"2 * (%s %% 4)", []*NamedType{{"out", "N"}}},
+				Type:    &NamedType{"foo", "Bar"},
+			},
+			"[2 * (N % 4)]Foo.Bar",
+		},
+	}
+
+	pt := PackageTable{
+		"crypto/sha256": "sha256",
+		"foo":           "Foo",
+		"out":           "",
+	}
+	for _, tt := range cases {
+		actual := tt.at.String(pt)
+		if actual != tt.expected {
+			t.Errorf(`expected "%s" actual "%s"`, tt.expected, actual)
+		}
+	}
+}